@@ -0,0 +1,100 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nshmura/dsio/core"
+	"github.com/nshmura/dsio/gql"
+)
+
+// getAggregationQuery converts COUNT, COUNT_UP_TO, SUM and AVG into aggregations of the query.
+// Aliases of the aggregations are in the order of the select clause.
+func getAggregationQuery(q *core.Query, aggregations []gql.AggregationExpr) (*core.Query, []core.Aggregation, error) {
+
+	// COUNT_UP_TO(n) counts at most n entities by limiting the nested query. LIMIT of the query is kept if it is smaller.
+	for _, a := range aggregations {
+		if a.Function != gql.AGG_COUNT_UP_TO {
+			continue
+		}
+		if len(aggregations) > 1 {
+			return nil, nil, errors.New("COUNT_UP_TO can not be used with other aggregations")
+		}
+		if a.UpTo <= 0 {
+			return nil, nil, fmt.Errorf("COUNT_UP_TO requires positive integer: %d", a.UpTo)
+		}
+		if q.Limit == 0 || a.UpTo < q.Limit {
+			limited := *q
+			limited.Limit = a.UpTo
+			q = &limited
+		}
+	}
+
+	result := make([]core.Aggregation, 0, len(aggregations))
+	used := make(map[string]bool, len(aggregations))
+
+	for _, a := range aggregations {
+		alias := a.Alias
+		if alias == "" {
+			alias = defaultAggregationAlias(a)
+		}
+		if used[alias] {
+			return nil, nil, fmt.Errorf("duplicate alias of aggregation: %s", alias)
+		}
+		used[alias] = true
+
+		var function core.AggregationFunction
+		switch a.Function {
+		case gql.AGG_COUNT, gql.AGG_COUNT_UP_TO:
+			function = core.AggregationCount
+		case gql.AGG_SUM:
+			function = core.AggregationSum
+		case gql.AGG_AVG:
+			function = core.AggregationAvg
+		default:
+			return nil, nil, fmt.Errorf("unsupported aggregation: %v", a.Function)
+		}
+		result = append(result, core.Aggregation{Function: function, Property: a.PropertyName, Alias: alias})
+	}
+
+	return q, result, nil
+}
+
+// defaultAggregationAlias returns alias like `count` or `sum_price`
+func defaultAggregationAlias(a gql.AggregationExpr) string {
+	switch a.Function {
+	case gql.AGG_COUNT:
+		return "count"
+	case gql.AGG_COUNT_UP_TO:
+		return "count_up_to"
+	case gql.AGG_SUM:
+		return "sum_" + a.PropertyName
+	case gql.AGG_AVG:
+		return "avg_" + a.PropertyName
+	}
+	return ""
+}
+
+func outputAggregation(storage core.Storage, format string, q *core.Query, aggregations []gql.AggregationExpr, writer io.Writer) error {
+
+	q, aggs, err := getAggregationQuery(q, aggregations)
+	if err != nil {
+		return err
+	}
+
+	result, err := storage.RunAggregationQuery(context.Background(), q, aggs)
+	if err != nil {
+		return err
+	}
+
+	aliases := make([]string, len(aggs))
+	values := make([]interface{}, len(aggs))
+	for i, a := range aggs {
+		aliases[i] = a.Alias
+		values[i] = result[a.Alias]
+	}
+
+	return core.ExportAggregation(writer, format, aliases, values)
+}
@@ -0,0 +1,297 @@
+package action
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nshmura/dsio/core"
+)
+
+// CheckpointSuffix is the suffix of checkpoint file
+const CheckpointSuffix = ".dsio-checkpoint"
+
+// checkpoint records the progress of upserting a file, so that the upsert can be resumed by --resume
+type checkpoint struct {
+	File      string              `json:"file"`
+	Hash      string              `json:"hash"`
+	BatchSize int                 `json:"batch_size"`
+	LastBatch int                 `json:"last_batch"`          // all batches up to this index are committed. -1 means none.
+	Committed []int               `json:"committed,omitempty"` // batches after LastBatch which are committed by parallel upsert
+	Failed    []checkpointFailure `json:"failed"`
+	checkpointTarget
+
+	path      string
+	committed map[int]bool // set of Committed
+	disabled  bool         // the checkpoint can not be written
+}
+
+// checkpointTarget is where entities are upserted. Batches committed to a target are not skipped for another one.
+type checkpointTarget struct {
+	Backend   string `json:"backend"`
+	ProjectID string `json:"project_id"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Mode      string `json:"mode"`
+}
+
+type checkpointFailure struct {
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// openCheckpoint returns a new checkpoint of the file in dir, or the checkpoint written before if resume is true
+func openCheckpoint(filename, dir string, batchSize int, target checkpointTarget, resume bool) (*checkpoint, error) {
+	hash, err := getFileHash(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{
+		File:             filename,
+		Hash:             hash,
+		BatchSize:        batchSize,
+		LastBatch:        -1,
+		Failed:           make([]checkpointFailure, 0),
+		checkpointTarget: target,
+		path:             checkpointPath(dir, filename),
+		committed:        make(map[int]bool),
+	}
+	if !resume {
+		return cp, nil
+	}
+
+	b, err := ioutil.ReadFile(cp.path)
+	if os.IsNotExist(err) {
+		core.Infof("No checkpoint of %s. Upserting from the beginning.\n", filename)
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved checkpoint
+	if err := core.DecodeJSON(string(b), &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", cp.path, err)
+	}
+	if saved.Hash != hash {
+		return nil, fmt.Errorf("%s has been changed since the checkpoint was written", filename)
+	}
+	if saved.BatchSize != batchSize {
+		return nil, fmt.Errorf("batch-size should be %d to resume from the checkpoint", saved.BatchSize)
+	}
+	if err := saved.checkpointTarget.check(target); err != nil {
+		return nil, err
+	}
+
+	cp.LastBatch = saved.LastBatch
+	for _, batch := range saved.Committed {
+		if batch > cp.LastBatch {
+			cp.committed[batch] = true
+			cp.Committed = append(cp.Committed, batch)
+		}
+	}
+	cp.Failed = append(cp.Failed, saved.Failed...)
+	return cp, nil
+}
+
+// getCheckpointTarget returns the target of the upsert by the context and options
+func getCheckpointTarget(ctx core.Context, opt UpsertOption) checkpointTarget {
+	return checkpointTarget{
+		Backend:   ctx.Backend,
+		ProjectID: ctx.ProjectID,
+		Namespace: ctx.Namespace,
+		Kind:      opt.Kind,
+		Mode:      opt.Mode,
+	}
+}
+
+// check returns an error if the upsert is resumed to another target than the checkpoint
+func (t checkpointTarget) check(current checkpointTarget) error {
+	for _, f := range []struct {
+		option          string
+		saved, resuming string
+	}{
+		{"backend", t.Backend, current.Backend},
+		{"project-id", t.ProjectID, current.ProjectID},
+		{"namespace", t.Namespace, current.Namespace},
+		{"kind", t.Kind, current.Kind},
+		{"mode", t.Mode, current.Mode},
+	} {
+		if f.saved != f.resuming {
+			return fmt.Errorf("%s should be %q to resume from the checkpoint, but is %q", f.option, f.saved, f.resuming)
+		}
+	}
+	return nil
+}
+
+// checkpointPath returns the checkpoint file of the input file in dir, or in the temporary directory if dir is empty.
+// The input file may be in a read-only directory, so the checkpoint is not written next to it,
+// and it is named by the absolute path of the input file.
+func checkpointPath(dir, filename string) string {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "dsio")
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	h := sha256.Sum256([]byte(filename))
+	return filepath.Join(dir, filepath.Base(filename)+"."+hex.EncodeToString(h[:8])+CheckpointSuffix)
+}
+
+func getFileHash(filename string) (string, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// start returns the index of the first entity which is not committed yet
+func (cp *checkpoint) start() int {
+	if cp == nil {
+		return 0
+	}
+	return (cp.LastBatch + 1) * cp.BatchSize
+}
+
+// isCommitted reports whether the batch was committed before resume
+func (cp *checkpoint) isCommitted(batch int) bool {
+	if cp == nil {
+		return false
+	}
+	return batch <= cp.LastBatch || cp.committed[batch]
+}
+
+// commit records the batch and its failures, and writes the checkpoint file.
+// Indexes of the failures are indexes in the batch which starts at the index `from`.
+func (cp *checkpoint) commit(batch int, failed []entityError, from int) {
+	if cp == nil {
+		return
+	}
+
+	cp.addFailures(failed, from)
+
+	// batches of parallel upsert are committed in random order
+	cp.committed[batch] = true
+	for cp.committed[cp.LastBatch+1] {
+		delete(cp.committed, cp.LastBatch+1)
+		cp.LastBatch++
+	}
+
+	// batches after a batch in progress are also saved, so that they are not upserted again by resume
+	cp.Committed = make([]int, 0, len(cp.committed))
+	for b := range cp.committed {
+		cp.Committed = append(cp.Committed, b)
+	}
+	sort.Ints(cp.Committed)
+	cp.save()
+}
+
+// failedIndexes returns indexes of entities which failed before resume, from the index `from` up to `to` (exclusive)
+func (cp *checkpoint) failedIndexes(from, to int) []int {
+	if cp == nil {
+		return nil
+	}
+
+	found := make(map[int]bool, len(cp.Failed))
+	indexes := make([]int, 0, len(cp.Failed))
+	for _, f := range cp.Failed {
+		if f.Index < from || f.Index >= to || found[f.Index] {
+			continue
+		}
+		found[f.Index] = true
+		indexes = append(indexes, f.Index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// retried replaces failures of the entities which were put again by the failures of the retry, and writes the checkpoint file.
+// Indexes of the failures are indexes in the file.
+func (cp *checkpoint) retried(indexes []int, failed []entityError) {
+	if cp == nil {
+		return
+	}
+
+	retried := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		retried[i] = true
+	}
+	rest := make([]checkpointFailure, 0, len(cp.Failed))
+	for _, f := range cp.Failed {
+		if !retried[f.Index] {
+			rest = append(rest, f)
+		}
+	}
+	cp.Failed = rest
+
+	cp.addFailures(failed, 0)
+	cp.save()
+}
+
+func (cp *checkpoint) addFailures(failed []entityError, from int) {
+	for _, e := range failed {
+		cp.Failed = append(cp.Failed, checkpointFailure{Index: from + e.index, Key: core.KeyToString(e.key), Error: e.err.Error()})
+	}
+}
+
+// isComplete reports whether all entities are committed
+func (cp *checkpoint) isComplete(total int) bool {
+	return cp.start() >= total
+}
+
+// save writes the checkpoint file. Upsert goes on without the checkpoint if it can not be written.
+func (cp *checkpoint) save() {
+	if cp.disabled {
+		return
+	}
+	if err := cp.write(); err != nil {
+		core.Infof("Can not write checkpoint %s, upserting without checkpoint: %v\n", cp.path, err)
+		cp.disabled = true
+	}
+}
+
+func (cp *checkpoint) write() error {
+	str, err := core.EncodeJSON(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0755); err != nil {
+		return err
+	}
+
+	// write into a temporary file first, so that the checkpoint is not broken when dsio dies
+	fp, err := ioutil.TempFile(filepath.Dir(cp.path), ".dsio-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fp.Name())
+
+	if _, err := fp.WriteString(str); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fp.Name(), cp.path)
+}
+
+func (cp *checkpoint) remove() {
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		core.Infof("Can not remove checkpoint %s: %v\n", cp.path, err)
+	}
+}
@@ -0,0 +1,296 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("../samples/yaml/many1200.yaml")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "many1200.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	cp, err := openCheckpoint(filename, dir, 500, checkpointTarget{}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, cp.start())
+
+	// batches committed in random order advance the checkpoint only when contiguous
+	key := datastore.NameKey("Many", "a", nil)
+	cp.commit(1, []entityError{{index: 2, key: key, err: errors.New("invalid")}}, 500)
+	assert.Equal(t, -1, cp.LastBatch)
+	cp.commit(0, nil, 0)
+	assert.Equal(t, 1, cp.LastBatch)
+
+	// resume from the checkpoint file
+	cp, err = openCheckpoint(filename, dir, 500, checkpointTarget{}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, cp.start())
+	assert.Equal(t, []checkpointFailure{{Index: 502, Key: core.KeyToString(key), Error: "invalid"}}, cp.Failed)
+
+	_, err = openCheckpoint(filename, dir, 100, checkpointTarget{}, true)
+	assert.Error(t, err)
+
+	// the failed entity and the rest of entities are upserted
+	_, entities, err := parseFile(filename, "", "")
+	assert.Nil(t, err)
+	ctx := core.Context{NonInteractive: true}
+	storage := core.NewMemoryStorage()
+	summary, err := upsertEntities(ctx, storage, entities, UpsertOption{BatchSize: 500, Mode: ModeUpsert}, cp, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, summary.upserted)
+	assert.Equal(t, 0, len(summary.failed))
+	assert.Equal(t, 0, len(cp.Failed))
+	assert.True(t, cp.isComplete(len(*entities)))
+
+	dst := make([]datastore.PropertyList, 1)
+	assert.Nil(t, storage.GetMulti(context.Background(), []*datastore.Key{(*entities)[502].Key}, dst))
+
+	// the file has been changed
+	assert.Nil(t, ioutil.WriteFile(filename, append(b, '\n'), 0644))
+	_, err = openCheckpoint(filename, dir, 500, checkpointTarget{}, true)
+	assert.Error(t, err)
+}
+
+func TestCheckpointTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "book.yaml")
+	b, err := ioutil.ReadFile("../samples/yaml/book.yaml")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	ctx := core.Context{Backend: core.BackendMemory, ProjectID: "project", Namespace: "dev"}
+	opt := UpsertOption{Kind: "Book", Mode: ModeUpsert}
+	target := getCheckpointTarget(ctx, opt)
+
+	cp, err := openCheckpoint(filename, dir, 500, target, false)
+	assert.Nil(t, err)
+	cp.commit(0, nil, 0)
+
+	// the same target is resumed
+	cp, err = openCheckpoint(filename, dir, 500, target, true)
+	assert.Nil(t, err)
+	assert.Equal(t, target, cp.checkpointTarget)
+	assert.True(t, cp.isCommitted(0))
+
+	// batches committed to another target are not skipped
+	for name, change := range map[string]func(*core.Context, *UpsertOption){
+		"backend":    func(c *core.Context, o *UpsertOption) { c.Backend = core.BackendFilePrefix + dir },
+		"project-id": func(c *core.Context, o *UpsertOption) { c.ProjectID = "other" },
+		"namespace":  func(c *core.Context, o *UpsertOption) { c.Namespace = "" },
+		"kind":       func(c *core.Context, o *UpsertOption) { o.Kind = "Author" },
+		"mode":       func(c *core.Context, o *UpsertOption) { o.Mode = ModeInsert },
+	} {
+		c, o := ctx, opt
+		change(&c, &o)
+		_, err = openCheckpoint(filename, dir, 500, getCheckpointTarget(c, o), true)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), name)
+		}
+	}
+}
+
+// rejectStorage fails puts of the key
+type rejectStorage struct {
+	*core.MemoryStorage
+	key *datastore.Key
+}
+
+func (s *rejectStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	errs := make(datastore.MultiError, len(keys))
+	failed := false
+	for i, k := range keys {
+		if k.Equal(s.key) {
+			errs[i], failed = errors.New("rejected"), true
+		}
+	}
+	if failed {
+		return nil, errs
+	}
+	return s.MemoryStorage.PutMulti(ctx, keys, src)
+}
+
+func TestCheckpointRetryFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("../samples/yaml/book.yaml")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "book.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	_, entities, err := parseFile(filename, "", "")
+	assert.Nil(t, err)
+	rejected := (*entities)[1].Key
+
+	// No.2 fails in the first run
+	storage := &rejectStorage{MemoryStorage: core.NewMemoryStorage(), key: rejected}
+	opt := UpsertOption{BatchSize: 500, Mode: ModeUpsert, CheckpointDir: dir}
+	summary, err := upsertFile(core.Context{NonInteractive: true}, storage, filename, opt)
+	assert.Error(t, err)
+	assert.Equal(t, len(*entities)-1, summary.upserted)
+
+	// the failure is retried and fails again, so the checkpoint is kept
+	opt.Resume = true
+	summary, err = upsertFile(core.Context{NonInteractive: true}, storage, filename, opt)
+	assert.Error(t, err)
+	assert.Equal(t, 0, summary.upserted)
+	assert.Equal(t, 1, len(summary.failed))
+	assert.Equal(t, 1, summary.failed[0].index)
+
+	cp, err := openCheckpoint(filename, dir, 500, getCheckpointTarget(core.Context{}, opt), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, cp.failedIndexes(0, len(*entities)))
+
+	// the failure succeeds by retry, and the checkpoint is removed
+	storage.key = nil
+	summary, err = upsertFile(core.Context{NonInteractive: true}, storage, filename, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.upserted)
+	_, err = os.Stat(checkpointPath(dir, filename))
+	assert.True(t, os.IsNotExist(err))
+
+	keys, err := getKeys(storage, &core.Query{Kind: rejected.Kind})
+	assert.Nil(t, err)
+	assert.Equal(t, len(*entities), len(keys))
+}
+
+func TestCheckpointNDJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeNDJSON(t, dir, 1050)
+	ctx := core.Context{NonInteractive: true}
+	rejected := datastore.IDKey("ManyEntities", 555, nil)
+
+	for _, concurrency := range []int{0, 3} {
+		// No.555 fails in the first run
+		storage := &rejectStorage{MemoryStorage: core.NewMemoryStorage(), key: rejected}
+		opt := UpsertOption{BatchSize: 100, Mode: ModeUpsert, Concurrency: concurrency, CheckpointDir: dir}
+		summary, err := upsertNDJSONFile(ctx, storage, filename, opt, false)
+		assert.Error(t, err, concurrency)
+		assert.Equal(t, 1049, summary.upserted, concurrency)
+		if assert.Equal(t, 1, len(summary.failed), concurrency) {
+			assert.Equal(t, 554, summary.failed[0].index, concurrency)
+		}
+
+		// only the failure is put again by resume, and the checkpoint is removed
+		storage.key = nil
+		opt.Resume = true
+		summary, err = upsertNDJSONFile(ctx, storage, filename, opt, false)
+		assert.Nil(t, err, concurrency)
+		assert.Equal(t, 1, summary.upserted, concurrency)
+		_, err = os.Stat(checkpointPath(dir, filename))
+		assert.True(t, os.IsNotExist(err), concurrency)
+
+		keys, err := getKeys(storage, &core.Query{Kind: rejected.Kind})
+		assert.Nil(t, err, concurrency)
+		assert.Equal(t, 1050, len(keys), concurrency)
+	}
+}
+
+func TestCheckpointCommittedBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("../samples/yaml/many1200.yaml")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "many1200.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	_, entities, err := parseFile(filename, "", "")
+	assert.Nil(t, err)
+	ctx := core.Context{NonInteractive: true}
+
+	for _, concurrency := range []int{1, 3} {
+		// batch 1 is committed while batch 0 is in progress
+		cp, err := openCheckpoint(filename, dir, 500, checkpointTarget{}, false)
+		assert.Nil(t, err)
+		cp.commit(1, nil, 500)
+		assert.Equal(t, -1, cp.LastBatch)
+
+		cp, err = openCheckpoint(filename, dir, 500, checkpointTarget{}, true)
+		assert.Nil(t, err)
+		assert.Equal(t, []int{1}, cp.Committed)
+		assert.Equal(t, 0, cp.start())
+		assert.True(t, cp.isCommitted(1))
+		assert.False(t, cp.isCommitted(2))
+
+		// batch 1 is not upserted again
+		opt := UpsertOption{BatchSize: 500, Mode: ModeUpsert, Concurrency: concurrency}
+		summary, err := upsertEntities(ctx, core.NewMemoryStorage(), entities, opt, cp, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 700, summary.upserted)
+		assert.Equal(t, 2, cp.LastBatch)
+		assert.True(t, cp.isComplete(len(*entities)))
+	}
+}
+
+func TestUpsertFileCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("../samples/yaml/book.yaml")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "book.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	// the checkpoint is removed after all entities are upserted
+	ctx := core.Context{NonInteractive: true}
+	_, err = upsertFile(ctx, core.NewMemoryStorage(), filename, UpsertOption{BatchSize: 500, Mode: ModeUpsert, Resume: true, CheckpointDir: dir})
+	assert.Nil(t, err)
+	_, err = os.Stat(checkpointPath(dir, filename))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = upsertFile(ctx, core.NewMemoryStorage(), StdinFilename, UpsertOption{BatchSize: 500, Mode: ModeUpsert, Format: core.FormatYAML, Resume: true})
+	assert.Error(t, err)
+}
+
+func TestCheckpointPath(t *testing.T) {
+	// checkpoints of files which have the same name in different directories are different
+	a := checkpointPath("cp", filepath.Join("a", "book.yaml"))
+	b := checkpointPath("cp", filepath.Join("b", "book.yaml"))
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, "cp", filepath.Dir(a))
+	assert.True(t, strings.HasPrefix(filepath.Base(a), "book.yaml."))
+	assert.True(t, strings.HasSuffix(a, CheckpointSuffix))
+
+	assert.Equal(t, filepath.Join(os.TempDir(), "dsio"), filepath.Dir(checkpointPath("", "book.yaml")))
+}
+
+func TestCheckpointNotWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := ioutil.ReadFile("../samples/yaml/book.yaml")
+	assert.Nil(t, err)
+	filename := filepath.Join(dir, "book.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, b, 0644))
+
+	// the checkpoint directory can not be created under a file
+	opt := UpsertOption{BatchSize: 500, Mode: ModeUpsert, CheckpointDir: filepath.Join(filename, "checkpoints")}
+	summary, err := upsertFile(core.Context{NonInteractive: true}, core.NewMemoryStorage(), filename, opt)
+	assert.Nil(t, err)
+	assert.True(t, summary.upserted > 0)
+}
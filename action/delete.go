@@ -0,0 +1,168 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"google.golang.org/api/iterator"
+)
+
+// Delete entities specified by file or GQL from datastore
+func Delete(ctx core.Context, filename, kind, format, gqlStr string, batchSize int) error {
+
+	if filename != "" && gqlStr != "" {
+		return errors.New("filename and query can not be specified at the same time")
+	} else if filename == "" && gqlStr == "" {
+		return errors.New("filename or query should be specified")
+	}
+
+	// BatchSize
+	batchSize, err := getBatchSize(batchSize)
+	if err != nil {
+		return err
+	}
+
+	// the query is run even in dry run
+	var storage core.Storage
+	if gqlStr != "" || !ctx.DryRun {
+		if storage, err = core.CreateStorage(ctx); err != nil {
+			return err
+		}
+		defer storage.Close()
+	}
+
+	// Keys
+	var keys []*datastore.Key
+	if filename != "" {
+		keys, err = getKeysFromFile(filename, kind, format)
+	} else {
+		keys, err = getKeysFromQuery(ctx, storage, gqlStr)
+	}
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	if len(keys) == 0 {
+		core.Info("No entities to delete.")
+		return nil
+	}
+
+	return deleteKeys(ctx, storage, keys, batchSize, true)
+}
+
+func deleteKeys(ctx core.Context, storage core.Storage, keys []*datastore.Key, batchSize int, confirm bool) error {
+
+	allPage := int(math.Ceil(float64(len(keys)) / float64(batchSize)))
+	for page := 0; page < allPage; page++ {
+
+		from := page * batchSize
+		to := (page + 1) * batchSize
+		if to > len(keys) {
+			to = len(keys)
+		}
+
+		// Confirm. Deleted entities can not be restored, so the first batch is also confirmed.
+		if confirm && page == 0 && !ctx.DryRun {
+			msg := fmt.Sprintf("Do you want to delete %d entities?", len(keys))
+			ok, err := core.ConfirmYesNo(msg)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		} else if confirm && page > 0 {
+			msg := fmt.Sprintf("Do you want to delete more entities (No.%d - No.%d)? ", from+1, to)
+			ok, err := core.ConfirmYesNoWithDefault(msg, true)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+		}
+
+		core.Infof("Deleting %d entities...\n", to-from)
+
+		for _, k := range keys[from:to] {
+			core.Infof(" entity> Key=%v\n", core.KeyToString(k))
+		}
+
+		if ctx.DryRun {
+			continue
+		}
+
+		// Delete multi entities
+		if err := storage.DeleteMulti(context.Background(), keys[from:to]); err != nil {
+			if me, ok := err.(datastore.MultiError); ok {
+				for i, e := range me {
+					if e != nil {
+						return fmt.Errorf("Delete error(entity No.%v): %v\n", from+i+1, e)
+					}
+				}
+			} else {
+				return fmt.Errorf("Delete error: %v\n", err)
+			}
+		} else {
+			core.Infof("%d entities were deleted successfully.\n", to-from)
+		}
+	}
+	return nil
+}
+
+func getKeysFromFile(filename, kind, format string) ([]*datastore.Key, error) {
+
+	_, dsEntities, err := parseFile(filename, kind, format)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*datastore.Key, 0, len(*dsEntities))
+	for i, e := range *dsEntities {
+		if e.Key.Incomplete() {
+			return nil, fmt.Errorf("key of entity No.%d is not specified", i+1)
+		}
+		keys = append(keys, e.Key)
+	}
+	return keys, nil
+}
+
+func getKeysFromQuery(ctx core.Context, storage core.Storage, gqlStr string) ([]*datastore.Key, error) {
+
+	kind, q, err := getKindQuery(ctx, gqlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	core.Debugf("kind = %v\n", kind)
+	core.Debugf("query = %+v\n", *q)
+
+	return getKeys(storage, q)
+}
+
+func getKeys(storage core.Storage, q *core.Query) ([]*datastore.Key, error) {
+	keysOnly := *q
+	keysOnly.KeysOnly = true
+
+	keys := make([]*datastore.Key, 0)
+	iter := storage.Run(context.Background(), &keysOnly)
+	for {
+		key, err := iter.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
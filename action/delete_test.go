@@ -0,0 +1,31 @@
+package action
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKeysFromQuery(t *testing.T) {
+	storage := core.NewMemoryStorage()
+	ctx := core.Context{NonInteractive: true}
+
+	keys := []*datastore.Key{
+		datastore.NameKey("Book", "a", nil),
+		datastore.NameKey("Book", "b", nil),
+	}
+	src := []datastore.PropertyList{
+		{{Name: "Price", Value: int64(100)}},
+		{{Name: "Price", Value: int64(2000)}},
+	}
+	_, err := storage.PutMulti(context.Background(), keys, src)
+	assert.Nil(t, err)
+
+	// keys come from the storage which is passed in
+	found, err := getKeysFromQuery(ctx, storage, "SELECT * FROM Book WHERE Price > 1000")
+	assert.Nil(t, err)
+	assert.Equal(t, []*datastore.Key{keys[1]}, found)
+}
@@ -0,0 +1,163 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+)
+
+type diffResult struct {
+	Entities []core.EntityDiff `json:"entities"`
+	New      int               `json:"new"`
+	Changed  int               `json:"changed"`
+	Equal    int               `json:"unchanged"`
+}
+
+// Diff entities in file against entities in datastore
+func Diff(ctx core.Context, filename, kind, format string, outputJSON bool) error {
+
+	// Parse
+	_, dsEntities, err := parseFile(filename, kind, format)
+	if err != nil {
+		return err
+	}
+
+	storage, err := core.CreateStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := diffEntities(storage, *dsEntities)
+	if err != nil {
+		return err
+	}
+
+	if outputJSON {
+		str, err := core.EncodeJSON(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(str)
+		return nil
+	}
+
+	printDiff(os.Stdout, result)
+	return nil
+}
+
+func diffEntities(storage core.Storage, entities []datastore.Entity) (diffResult, error) {
+	result := diffResult{
+		Entities: make([]core.EntityDiff, 0, len(entities)),
+	}
+
+	for from := 0; from < len(entities); from += MaxBatchSize {
+		to := from + MaxBatchSize
+		if to > len(entities) {
+			to = len(entities)
+		}
+
+		remotes, found, err := getRemoteEntities(storage, entities[from:to])
+		if err != nil {
+			return result, err
+		}
+
+		for i, e := range entities[from:to] {
+			d := core.EntityDiff{Key: core.KeyToString(e.Key)}
+			if e.Key.Incomplete() {
+				d.Key = "(auto)"
+			}
+
+			var remote []datastore.Property
+			if found[i] {
+				d.Status = core.StatusChanged
+				remote = remotes[i]
+			} else {
+				d.Status = core.StatusNew
+			}
+
+			if d.Properties, err = core.DiffProperties(e.Properties, remote); err != nil {
+				return result, fmt.Errorf("Diff error(entity No.%v): %v", from+i+1, err)
+			}
+
+			switch {
+			case d.Status == core.StatusNew:
+				result.New++
+			case len(d.Properties) == 0:
+				d.Status = core.StatusUnchanged
+				result.Equal++
+			default:
+				result.Changed++
+			}
+			result.Entities = append(result.Entities, d)
+		}
+	}
+	return result, nil
+}
+
+func getRemoteEntities(storage core.Storage, entities []datastore.Entity) ([]datastore.PropertyList, []bool, error) {
+	remotes := make([]datastore.PropertyList, len(entities))
+	found := make([]bool, len(entities))
+
+	// entities with incomplete key are always new
+	keys := make([]*datastore.Key, 0, len(entities))
+	indexes := make([]int, 0, len(entities))
+	for i, e := range entities {
+		if !e.Key.Incomplete() {
+			keys = append(keys, e.Key)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(keys) == 0 {
+		return remotes, found, nil
+	}
+
+	dst := make([]datastore.PropertyList, len(keys))
+	err := storage.GetMulti(context.Background(), keys, dst)
+	me, isMultiError := err.(datastore.MultiError)
+	if err != nil && !isMultiError {
+		return nil, nil, err
+	}
+
+	for j, i := range indexes {
+		if isMultiError && me[j] != nil {
+			if me[j] == datastore.ErrNoSuchEntity {
+				continue
+			}
+			return nil, nil, fmt.Errorf("Get error(key %v): %v", core.KeyToString(keys[j]), me[j])
+		}
+		remotes[i] = dst[j]
+		found[i] = true
+	}
+	return remotes, found, nil
+}
+
+func printDiff(w io.Writer, result diffResult) {
+	for _, e := range result.Entities {
+		if e.Status == core.StatusUnchanged {
+			continue
+		}
+
+		fmt.Fprintf(w, "Key=%v (%v)\n", e.Key, e.Status)
+		for _, p := range e.Properties {
+			switch p.Type {
+			case core.DiffAdded:
+				fmt.Fprintf(w, "  + %s: %v (%v)\n", p.Name, p.NewValue, p.NewType)
+			case core.DiffRemoved:
+				fmt.Fprintf(w, "  - %s: %v (%v)\n", p.Name, p.OldValue, p.OldType)
+			case core.DiffChangedValue:
+				fmt.Fprintf(w, "  ~ %s: %v -> %v\n", p.Name, p.OldValue, p.NewValue)
+			case core.DiffChangedType:
+				fmt.Fprintf(w, "  ~ %s: %v (%v) -> %v (%v)\n", p.Name, p.OldValue, p.OldType, p.NewValue, p.NewType)
+			case core.DiffChangedNoIndex:
+				fmt.Fprintf(w, "  ~ %s: noindex %v -> %v\n", p.Name, p.OldNoIndex, p.NewNoIndex)
+			}
+		}
+	}
+
+	core.Infof("%d new, %d changed, %d unchanged entities.\n", result.New, result.Changed, result.Equal)
+}
@@ -0,0 +1,108 @@
+package action
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nshmura/dsio/core"
+)
+
+// Export all kinds in the namespace into files in the directory. One file is created per kind.
+func Export(ctx core.Context, dir, format string, style core.TypeStyle) error {
+
+	storage, err := core.CreateStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	kinds, err := getKinds(storage, ctx.Namespace)
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 {
+		core.Infof("No kinds in namespace '%s'.\n", ctx.Namespace)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, kind := range kinds {
+		filename := exportFilename(dir, kind, format)
+		if err := exportKind(ctx, storage, kind, filename, format, style); err != nil {
+			return fmt.Errorf("Export error(kind %s): %v", kind, err)
+		}
+	}
+	return nil
+}
+
+// exportFilename returns the file of the kind in the directory.
+// Path separators in the kind name are escaped, so that the file is not written outside of the directory.
+func exportFilename(dir, kind, format string) string {
+	return filepath.Join(dir, url.PathEscape(kind)+"."+format)
+}
+
+// getKinds returns names of kinds in the namespace by __kind__ metadata query
+func getKinds(storage core.Storage, namespace string) ([]string, error) {
+	keys, err := getKeys(storage, &core.Query{Kind: "__kind__", Namespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make([]string, 0, len(keys))
+	for _, k := range keys {
+		// skip special kinds like __Stat_Kind__
+		if !strings.HasPrefix(k.Name, "__") {
+			kinds = append(kinds, k.Name)
+		}
+	}
+	return kinds, nil
+}
+
+func exportKind(ctx core.Context, storage core.Storage, kind, filename, format string, style core.TypeStyle) error {
+
+	// All entities are dumped at once, so that the scheme covers all properties of the kind.
+	q := &core.Query{Kind: kind, Namespace: ctx.Namespace}
+	keys, entities, err := core.GetAll(context.Background(), storage, q)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	fp, err := openFile(filename)
+	if err != nil {
+		return err
+	}
+	if fp == nil {
+		// not over-written
+		return nil
+	}
+	defer fp.Close()
+
+	w := bufio.NewWriter(fp)
+
+	exporter := getExporter(ctx, format, style, kind, w)
+	if err := exporter.DumpScheme(keys, entities); err != nil {
+		return err
+	}
+	if err := exporter.DumpEntities(keys, entities); err != nil {
+		return err
+	}
+
+	// errors of buffered writes are reported by Flush
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	core.Infof("%d entities of %s were exported into %s\n", len(keys), kind, filename)
+	return nil
+}
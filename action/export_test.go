@@ -0,0 +1,92 @@
+package action
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportFilename(t *testing.T) {
+	dir := filepath.Join("out", "export")
+	for _, c := range []struct {
+		kind     string
+		expected string
+	}{
+		{"Book", "Book.yaml"},
+		{"../Book", "..%2FBook.yaml"},
+		{"a/b", "a%2Fb.yaml"},
+		{`a\b`, "a%5Cb.yaml"},
+		{"..", "...yaml"},
+	} {
+		filename := exportFilename(dir, c.kind, "yaml")
+		assert.Equal(t, filepath.Join(dir, c.expected), filename, c.kind)
+		assert.Equal(t, dir, filepath.Dir(filename), c.kind)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	storage := core.NewMemoryStorage()
+	ctx := core.Context{NonInteractive: true}
+
+	author := datastore.NameKey("Author", "huxley", nil)
+	keys := []*datastore.Key{
+		datastore.NameKey("Book", "b", nil),
+		datastore.IDKey("Book", 2, nil),
+	}
+	src := []datastore.PropertyList{
+		{
+			{Name: "Title", Value: "Brave New World"},
+			{Name: "Price", Value: 18.0},
+			{Name: "Sort", Value: int64(100)},
+			{Name: "Public", Value: true},
+			{Name: "Published", Value: time.Date(1932, 1, 1, 12, 0, 0, 0, time.UTC)},
+			{Name: "Author", Value: author},
+			{Name: "Tags", Value: []interface{}{"a", "b"}},
+			{Name: "Note", Value: "long", NoIndex: true},
+		},
+		{
+			{Name: "Title", Value: "Island"},
+			{Name: "Price", Value: 9.5},
+			{Name: "Sort", Value: int64(200)},
+			{Name: "Public", Value: false},
+			{Name: "Published", Value: time.Date(1962, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Name: "Author", Value: author},
+			{Name: "Tags", Value: []interface{}{}},
+			{Name: "Note", Value: nil, NoIndex: true},
+		},
+	}
+	_, err = storage.PutMulti(context.Background(), keys, src)
+	assert.Nil(t, err)
+
+	for _, format := range []string{core.FormatYAML, core.FormatJSON, core.FormatNDJSON} {
+		for _, style := range []core.TypeStyle{core.StyleScheme, core.StyleDirect, core.StyleAuto} {
+			name := format + "/" + string(style)
+			filename := filepath.Join(dir, string(style)+"."+format)
+			if !assert.Nil(t, exportKind(ctx, storage, "Book", filename, format, style), name) {
+				continue
+			}
+
+			// entities in the exported file are the same as the stored ones
+			_, entities, err := parseFile(filename, "", "")
+			if !assert.Nil(t, err, name) {
+				continue
+			}
+			assert.ElementsMatch(t, keys, []*datastore.Key{(*entities)[0].Key, (*entities)[1].Key}, name)
+
+			result, err := diffEntities(storage, *entities)
+			assert.Nil(t, err, name)
+			assert.Equal(t, len(keys), result.Equal, name)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package action
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+)
+
+// loadFileStorage loads entities in the file into a memory storage, so that queries are evaluated without Datastore.
+func loadFileStorage(ctx core.Context, filename string) (*core.MemoryStorage, error) {
+	_, entities, err := parseFile(filename, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return newLocalStorage(ctx, *entities)
+}
+
+// newLocalStorage returns a memory storage which has the entities.
+// Namespaces of keys are replaced by the namespace in context, since entities in a file are a single dataset.
+func newLocalStorage(ctx core.Context, entities []datastore.Entity) (*core.MemoryStorage, error) {
+	keys := make([]*datastore.Key, len(entities))
+	src := make([]datastore.PropertyList, len(entities))
+	for i, e := range entities {
+		keys[i] = withNamespace(e.Key, ctx.Namespace)
+		src[i] = datastore.PropertyList(e.Properties)
+	}
+
+	storage := core.NewMemoryStorage()
+	if _, err := storage.PutMulti(context.Background(), keys, src); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+// withNamespace returns a copy of the key and its ancestors in the namespace
+func withNamespace(k *datastore.Key, namespace string) *datastore.Key {
+	if k == nil {
+		return nil
+	}
+	key := *k
+	key.Namespace = namespace
+	key.Parent = withNamespace(k.Parent, namespace)
+	return &key
+}
@@ -0,0 +1,172 @@
+package action
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+func localEntities() []datastore.Entity {
+	huxley := datastore.NameKey("Author", "Huxley", nil)
+	orwell := datastore.NameKey("Author", "Orwell", nil)
+
+	return []datastore.Entity{
+		{Key: huxley, Properties: []datastore.Property{{Name: "Name", Value: "Aldous Huxley"}}},
+		{Key: datastore.IDKey("Book", 3, orwell), Properties: []datastore.Property{
+			{Name: "Title", Value: "Animal Farm"},
+			{Name: "Price", Value: int64(8)},
+			{Name: "Tags", Value: []interface{}{"fable"}},
+		}},
+		{Key: datastore.IDKey("Book", 1, huxley), Properties: []datastore.Property{
+			{Name: "Title", Value: "Brave New World"},
+			{Name: "Price", Value: int64(10)},
+			{Name: "Tags", Value: []interface{}{"novel", "dystopia"}},
+		}},
+		{Key: datastore.IDKey("Book", 2, orwell), Properties: []datastore.Property{
+			{Name: "Title", Value: "1984"},
+			{Name: "Price", Value: 9.5},
+			{Name: "Tags", Value: []interface{}{"novel", "dystopia"}},
+			{Name: "Memo", Value: "classic", NoIndex: true},
+		}},
+	}
+}
+
+func localRun(t *testing.T, query string, params ...string) core.Iterator {
+	s, err := parseGQL(query)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	p, err := ParseParams(params)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, q, err := getQuery(core.Context{}, s, p)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	storage, err := newLocalStorage(core.Context{}, localEntities())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return storage.Run(context.Background(), q)
+}
+
+func localQuery(t *testing.T, query string, params ...string) ([]*datastore.Key, []datastore.PropertyList) {
+	iter := localRun(t, query, params...)
+
+	var keys []*datastore.Key
+	var entities []datastore.PropertyList
+	for {
+		var pl datastore.PropertyList
+		key, err := iter.Next(&pl)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		keys = append(keys, key)
+		entities = append(entities, pl)
+	}
+	return keys, entities
+}
+
+func keyIDs(keys []*datastore.Key) []int64 {
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID
+	}
+	return ids
+}
+
+func TestLocalQueryFilter(t *testing.T) {
+	keys, _ := localQuery(t, "SELECT * FROM Book")
+	assert.Equal(t, []int64{1, 2, 3}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book WHERE Price >= 9")
+	assert.Equal(t, []int64{1, 2}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book WHERE Tags = 'novel' AND (Price < 10 OR Title = 'Animal Farm')")
+	assert.Equal(t, []int64{2}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book WHERE Title IN ARRAY('1984', 'Animal Farm') AND Price != @price", "price=int:8")
+	assert.Equal(t, []int64{2}, keyIDs(keys))
+
+	// noindex property can not be filtered
+	keys, _ = localQuery(t, "SELECT * FROM Book WHERE Memo = 'classic'")
+	assert.Equal(t, 0, len(keys))
+}
+
+func TestLocalQueryAncestor(t *testing.T) {
+	keys, _ := localQuery(t, "SELECT * FROM Book WHERE __key__ HAS ANCESTOR KEY(Author, 'Orwell')")
+	assert.Equal(t, []int64{2, 3}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * WHERE __key__ HAS ANCESTOR KEY(Author, 'Huxley')")
+	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, "Author", keys[0].Kind)
+	assert.Equal(t, "Book", keys[1].Kind)
+}
+
+func TestLocalQueryOrder(t *testing.T) {
+	keys, _ := localQuery(t, "SELECT * FROM Book ORDER BY Price DESC")
+	assert.Equal(t, []int64{1, 2, 3}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book ORDER BY Tags, Price")
+	assert.Equal(t, []int64{2, 1, 3}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book ORDER BY Price LIMIT 2 OFFSET 1")
+	assert.Equal(t, []int64{2, 1}, keyIDs(keys))
+}
+
+func TestLocalQueryProjection(t *testing.T) {
+	keys, entities := localQuery(t, "SELECT __key__ FROM Book")
+	assert.Equal(t, 3, len(keys))
+	assert.Equal(t, 0, len(entities[0]))
+
+	_, entities = localQuery(t, "SELECT Title FROM Book ORDER BY Title")
+	assert.Equal(t, datastore.PropertyList{{Name: "Title", Value: "1984"}}, entities[0])
+
+	keys, _ = localQuery(t, "SELECT DISTINCT ON (Tags) Title FROM Book")
+	assert.Equal(t, []int64{1, 3}, keyIDs(keys))
+}
+
+func TestLocalQueryCursor(t *testing.T) {
+	iter := localRun(t, "SELECT * FROM Book LIMIT @end", "end=abc")
+	_, err := iter.Next(nil)
+	assert.Error(t, err)
+
+	// resume from the cursor after the first entity
+	iter = localRun(t, "SELECT * FROM Book LIMIT 1")
+	_, err = iter.Next(nil)
+	assert.Nil(t, err)
+	cursor, err := iter.Cursor()
+	assert.Nil(t, err)
+
+	keys, _ := localQuery(t, "SELECT * FROM Book OFFSET @start", "start="+cursor)
+	assert.Equal(t, []int64{2, 3}, keyIDs(keys))
+
+	keys, _ = localQuery(t, "SELECT * FROM Book LIMIT @end", "end="+cursor)
+	assert.Equal(t, []int64{1}, keyIDs(keys))
+}
+
+func TestLocalAggregation(t *testing.T) {
+	s, err := parseGQL("SELECT COUNT(*), SUM(Price), AVG(Price) FROM Book WHERE Tags = 'novel'")
+	assert.Nil(t, err)
+	_, q, err := getQuery(core.Context{}, s, nil)
+	assert.Nil(t, err)
+	q, aggs, err := getAggregationQuery(q, s.Aggregations)
+	assert.Nil(t, err)
+
+	storage, err := newLocalStorage(core.Context{}, localEntities())
+	assert.Nil(t, err)
+	result, err := storage.RunAggregationQuery(context.Background(), q, aggs)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result["count"])
+	assert.Equal(t, 19.5, result["sum_Price"])
+	assert.Equal(t, 9.75, result["avg_Price"])
+}
@@ -0,0 +1,192 @@
+package action
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nshmura/dsio/gql"
+)
+
+// ParseParams parses parameters of binding sites in `name=value` or `1=value` format.
+// The value can have type prefix like `int:10`, `datetime:2017-01-02T15:04:05Z` or `key:Book,1`. Value without prefix is a string.
+func ParseParams(params []string) (map[string]gql.ValueExpr, error) {
+
+	values := make(map[string]gql.ValueExpr, len(params))
+	for _, p := range params {
+		i := strings.Index(p, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("parameter should be name=value: %s", p)
+		}
+		name := strings.TrimPrefix(p[:i], "@")
+
+		value, err := parseParamValue(p[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter @%s: %v", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func parseParamValue(str string) (gql.ValueExpr, error) {
+
+	typ, v := "string", str
+	if i := strings.Index(str, ":"); i > 0 {
+		switch prefix := strings.ToLower(str[:i]); prefix {
+		case "string", "int", "integer", "float", "double", "bool", "boolean", "datetime", "key", "blob", "null":
+			typ, v = prefix, str[i+1:]
+		}
+	}
+
+	switch typ {
+	case "int", "integer":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return gql.ValueExpr{}, err
+		}
+		return gql.ValueExpr{Type: gql.TYPE_INTEGER, V: n}, nil
+
+	case "float", "double":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return gql.ValueExpr{}, err
+		}
+		return gql.ValueExpr{Type: gql.TYPE_DOUBLE, V: f}, nil
+
+	case "bool", "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return gql.ValueExpr{}, err
+		}
+		return gql.ValueExpr{Type: gql.TYPE_BOOL, V: b}, nil
+
+	case "datetime":
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return gql.ValueExpr{}, err
+		}
+		return gql.ValueExpr{Type: gql.TYPE_DATETIME, V: t}, nil
+
+	case "key":
+		return parseKeyParam(v)
+
+	case "blob":
+		return gql.ValueExpr{Type: gql.TYPE_BLOB, V: gql.BlobLiteralExpr{Blob: v}}, nil
+
+	case "null":
+		return gql.ValueExpr{Type: gql.TYPE_NULL, V: nil}, nil
+
+	default:
+		return gql.ValueExpr{Type: gql.TYPE_STRING, V: v}, nil
+	}
+}
+
+// parseKeyParam parses key path like `Author, 'Huxley', Book, 1` or `KEY(...)` by GQL parser
+func parseKeyParam(v string) (gql.ValueExpr, error) {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(v)), "KEY") {
+		v = "KEY(" + v + ")"
+	}
+
+	s, err := parseGQL("SELECT * WHERE __key__ = " + v)
+	if err != nil {
+		return gql.ValueExpr{}, err
+	}
+	if len(s.Where) != 1 || s.Where[0].GetValue().Type != gql.TYPE_KEY {
+		return gql.ValueExpr{}, fmt.Errorf("invalid key: %s", v)
+	}
+	return s.Where[0].GetValue(), nil
+}
+
+// bindParams replaces binding sites in conditions with parameters
+func bindParams(where []gql.ConditionExpr, params map[string]gql.ValueExpr) ([]gql.ConditionExpr, error) {
+
+	bound := make([]gql.ConditionExpr, len(where))
+	for i, c := range where {
+		switch t := c.(type) {
+		case gql.ForwardConditionExpr:
+			v, err := bindValue(t.Value, params)
+			if err != nil {
+				return nil, err
+			}
+			t.Value = v
+			bound[i] = t
+
+		case gql.BackwardConditionExpr:
+			v, err := bindValue(t.Value, params)
+			if err != nil {
+				return nil, err
+			}
+			t.Value = v
+			bound[i] = t
+
+		case gql.CompositeConditionExpr:
+			conditions, err := bindParams(t.Conditions, params)
+			if err != nil {
+				return nil, err
+			}
+			t.Conditions = conditions
+			bound[i] = t
+
+		default:
+			bound[i] = c
+		}
+	}
+	return bound, nil
+}
+
+func bindValue(v gql.ValueExpr, params map[string]gql.ValueExpr) (gql.ValueExpr, error) {
+	switch v.Type {
+	case gql.TYPE_BINDING_SITE:
+		name := v.V.(string)
+		p, ok := params[name]
+		if !ok {
+			return v, unboundError(name)
+		}
+		return p, nil
+
+	case gql.TYPE_ARRAY:
+		exprs := v.V.([]gql.ValueExpr)
+		values := make([]gql.ValueExpr, len(exprs))
+		for i, e := range exprs {
+			b, err := bindValue(e, params)
+			if err != nil {
+				return v, err
+			}
+			values[i] = b
+		}
+		return gql.ValueExpr{Type: gql.TYPE_ARRAY, V: values}, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// bindResultPosition resolves binding site of LIMIT or OFFSET. The parameter is an integer or a cursor string.
+// The cursor is validated by the storage which runs the query.
+func bindResultPosition(name string, params map[string]gql.ValueExpr) (string, int, error) {
+	p, ok := params[name]
+	if !ok {
+		return "", 0, unboundError(name)
+	}
+
+	switch p.Type {
+	case gql.TYPE_INTEGER:
+		return "", int(p.V.(int64)), nil
+
+	case gql.TYPE_STRING:
+		cursor := p.V.(string)
+		if cursor == "" {
+			return "", 0, fmt.Errorf("invalid cursor @%s: empty string", name)
+		}
+		return cursor, 0, nil
+
+	default:
+		return "", 0, fmt.Errorf("parameter @%s should be an integer or a cursor", name)
+	}
+}
+
+func unboundError(name string) error {
+	return fmt.Errorf("parameter @%s is not bound. use --param %s=value", name, name)
+}
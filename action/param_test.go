@@ -0,0 +1,80 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/nshmura/dsio/gql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParams(t *testing.T) {
+	params, err := ParseParams([]string{
+		"title=Brave New World",
+		"1=int:100",
+		"@price=float:1.5",
+		"public=bool:true",
+		"created=datetime:2017-01-02T15:04:05Z",
+		"author=key:Author, 'Huxley'",
+		"url=http://example.com",
+		"none=null:",
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_STRING, V: "Brave New World"}, params["title"])
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_INTEGER, V: int64(100)}, params["1"])
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_DOUBLE, V: 1.5}, params["price"])
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_BOOL, V: true}, params["public"])
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_DATETIME, V: time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)}, params["created"])
+	assert.Equal(t, gql.TYPE_KEY, params["author"].Type)
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_STRING, V: "http://example.com"}, params["url"])
+	assert.Equal(t, gql.ValueExpr{Type: gql.TYPE_NULL, V: nil}, params["none"])
+
+	_, err = ParseParams([]string{"count=int:abc"})
+	assert.Error(t, err)
+
+	_, err = ParseParams([]string{"count"})
+	assert.Error(t, err)
+}
+
+func TestBindParams(t *testing.T) {
+	s, err := parseGQL("SELECT * FROM Book WHERE Title = @title AND @1 < Sort AND Author = @author AND Tags IN ARRAY(@1, 'x')")
+	assert.Nil(t, err)
+
+	params, err := ParseParams([]string{"title=abc", "1=int:100", "author=key:Author,'Huxley'"})
+	assert.Nil(t, err)
+
+	where, err := bindParams(s.Where, params)
+	assert.Nil(t, err)
+
+	f, _, err := getFilters(core.Context{}, where)
+	assert.Nil(t, err)
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "Title", Operator: "=", Value: "abc"},
+		datastore.PropertyFilter{FieldName: "Sort", Operator: ">", Value: int64(100)},
+		datastore.PropertyFilter{FieldName: "Author", Operator: "=", Value: datastore.NameKey("Author", "Huxley", nil)},
+		datastore.PropertyFilter{FieldName: "Tags", Operator: "in", Value: []interface{}{int64(100), "x"}},
+	}, f)
+
+	_, err = bindParams(s.Where, map[string]gql.ValueExpr{"title": params["title"]})
+	assert.Error(t, err)
+}
+
+func TestBindResultPosition(t *testing.T) {
+	params, err := ParseParams([]string{"limit=int:10", "start=abc"})
+	assert.Nil(t, err)
+
+	cursor, number, err := bindResultPosition("limit", params)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+	assert.Equal(t, 10, number)
+
+	cursor, _, err = bindResultPosition("start", params)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", cursor)
+
+	_, _, err = bindResultPosition("end", params)
+	assert.Error(t, err)
+}
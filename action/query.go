@@ -3,9 +3,11 @@ package action
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -15,34 +17,105 @@ import (
 	"google.golang.org/api/iterator"
 )
 
+// QueryOption is options of Query
+type QueryOption struct {
+	Format      string
+	Style       core.TypeStyle
+	Output      string
+	PageSize    int
+	MaxEntities int
+	Params      []string
+	StartCursor string
+	FromFile    string
+}
+
 // Query entities from datastore to stdout
-func Query(ctx core.Context, gqlStr, format string, style core.TypeStyle, filename string, pageSize int) error {
+func Query(ctx core.Context, gqlStr string, opt QueryOption) error {
 
 	// Prepare io.writer
 	var writer io.Writer = os.Stdout
-	if filename != "" {
-		fp, err := openFile(filename)
+	if opt.Output != "" {
+		fp, err := openFile(opt.Output)
+		if err != nil {
+			return err
+		}
 		if fp == nil {
+			// not over-written
 			return nil
 		}
 		defer fp.Close()
-		if err != nil {
-			return err
-		}
 		w := bufio.NewWriter(fp)
 		defer w.Flush()
 		writer = w
 	}
 
-	if gqlStr == "" {
-		var err error
-		gqlStr, err = readQuery()
-		if err != nil {
+	// Without query, start the shell on terminal
+	if gqlStr == "" && core.IsTerminal(os.Stdin) {
+		return Shell(ctx, opt, writer)
+	}
+
+	storage, err := openQueryStorage(ctx, opt)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// Read statements from the pipe
+	if gqlStr == "" || gqlStr == StdinFilename {
+		return runStatements(ctx, storage, os.Stdin, opt, writer)
+	}
+
+	return runQuery(ctx, storage, gqlStr, opt, writer)
+}
+
+// openQueryStorage returns the storage which queries are run against. Entities in the file are evaluated without Datastore.
+func openQueryStorage(ctx core.Context, opt QueryOption) (core.Storage, error) {
+	if opt.FromFile != "" {
+		return loadFileStorage(ctx, opt.FromFile)
+	}
+	return core.CreateStorage(ctx)
+}
+
+// runStatements executes GQL statements separated by `;` in the reader.
+// Results in YAML format are separated by `---`, so that the output can be read as one file.
+func runStatements(ctx core.Context, storage core.Storage, r io.Reader, opt QueryOption, writer io.Writer) error {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	statements, rest := splitStatements(string(b))
+	if s := strings.TrimSpace(rest); s != "" {
+		statements = append(statements, s)
+	}
+	if len(statements) == 0 {
+		return errors.New("no query in stdin")
+	}
+
+	for i, s := range statements {
+		if i > 0 && opt.Format == core.FormatYAML {
+			fmt.Fprintln(writer, "---")
+		}
+		if err := runQuery(ctx, storage, s, opt, writer); err != nil {
+			if len(statements) > 1 {
+				return fmt.Errorf("statement %d: %v", i+1, err)
+			}
 			return err
 		}
 	}
+	return nil
+}
+
+// runQuery executes a GQL statement against the storage and outputs the result to the writer
+func runQuery(ctx core.Context, storage core.Storage, gqlStr string, opt QueryOption, writer io.Writer) error {
+
+	params, err := ParseParams(opt.Params)
+	if err != nil {
+		return err
+	}
 
-	kind, q, err := getKindQuery(ctx, gqlStr)
+	selectExpr, err := parseGQL(gqlStr)
 	if err != nil {
 		if err == io.EOF {
 			return nil
@@ -50,45 +123,57 @@ func Query(ctx core.Context, gqlStr, format string, style core.TypeStyle, filena
 		return err
 	}
 
+	kind, q, err := getQuery(ctx, selectExpr, params)
+	if err != nil {
+		return err
+	}
+
+	// Resume from the cursor
+	if opt.StartCursor != "" {
+		q.Start = opt.StartCursor
+	}
+
 	core.Debugf("kind = %v\n", kind)
-	core.Debugf("query = %q\n", q)
+	core.Debugf("query = %+v\n", *q)
+
+	// Aggregation query outputs only the result of aggregations
+	if len(selectExpr.Aggregations) > 0 {
+		return outputAggregation(storage, opt.Format, q, selectExpr.Aggregations, writer)
+	}
 
 	// Exporter
-	exporter := getExporter(ctx, format, style, kind, writer)
+	exporter := getExporter(ctx, opt.Format, opt.Style, kind, writer)
 
 	// Output entities
-	if err = outputEntities(ctx, pageSize, kind, q, exporter); err != nil {
-		return err
-	}
-	return nil
+	iter := storage.Run(context.Background(), q)
+	return outputIterator(iter, opt.PageSize, opt.MaxEntities, exporter)
 
 }
 
-func readQuery() (string, error) {
-	info, err := os.Stdin.Stat()
+func getKindQuery(ctx core.Context, gqlStr string, params map[string]gql.ValueExpr) (string, *core.Query, error) {
+
+	// Parse GQL
+	selectExpr, err := parseGQL(gqlStr)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-
-	if (info.Mode() & os.ModeCharDevice) == os.ModeCharDevice {
-		fmt.Print("gql> ")
-		return bufio.NewReader(os.Stdin).ReadString('\n')
-
-	} else {
-		return "", errors.New("pipe not supported")
+	if len(selectExpr.Aggregations) > 0 {
+		return "", nil, errors.New("aggregation query can not be used here")
 	}
+
+	return getQuery(ctx, selectExpr, params)
 }
 
-func getKindQuery(ctx core.Context, gqlStr string) (string, *datastore.Query, error) {
+func getQuery(ctx core.Context, selectExpr *gql.SelectExpr, params map[string]gql.ValueExpr) (string, *core.Query, error) {
 
-	// Parse GQL
-	selectExpr, err := parseGQL(gqlStr)
-	if err != nil {
+	// Bind parameters
+	var err error
+	if selectExpr.Where, err = bindParams(selectExpr.Where, params); err != nil {
 		return "", nil, err
 	}
 
-	// Convert to datastore's query
-	kind, q, err := convertToDatastoreQuery(ctx.Namespace, selectExpr)
+	// Convert to dsio's query
+	kind, q, err := convertToQuery(ctx, selectExpr, params)
 	if err != nil {
 		return "", nil, err
 	}
@@ -109,124 +194,356 @@ func parseGQL(gqlStr string) (*gql.SelectExpr, error) {
 	return &selectExpr, nil
 }
 
-func convertToDatastoreQuery(namespace string, s *gql.SelectExpr) (string, *datastore.Query, error) {
+func convertToQuery(ctx core.Context, s *gql.SelectExpr, params map[string]gql.ValueExpr) (string, *core.Query, error) {
 
-	// Kind
+	// Kind. Query without FROM is a kindless query.
 	var kind string
 	if s.From != nil && s.From.Kind != nil {
 		kind = s.From.Kind.Name
-	} else {
-		return "", nil, errors.New("sorry. kindless query is not supported") //TODO
+	} else if err := validateKindlessQuery(s); err != nil {
+		return "", nil, err
 	}
 
-	q := datastore.NewQuery(kind).Namespace(namespace)
+	q := &core.Query{Kind: kind, Namespace: ctx.Namespace}
 
 	// Fields
-	if s.Field.Distinct {
-		q = q.Distinct()
-	}
-	flen := len(s.Field.Field)
-	if flen == 1 {
-		if core.IsKeyValueName(s.Field.Field[0]) {
-			q = q.KeysOnly()
-		} else {
-
-			q = q.Project(s.Field.Field[0])
-		}
-	} else if flen > 1 {
-		q = q.Project(s.Field.Field...)
-	}
-	if len(s.Field.DistinctOnField) > 0 {
-		q = q.DistinctOn(s.Field.DistinctOnField...)
+	q.Distinct = s.Field.Distinct
+	if len(s.Field.Field) == 1 && core.IsKeyValueName(s.Field.Field[0]) {
+		q.KeysOnly = true
+	} else if len(s.Field.Field) > 0 {
+		q.Projection = s.Field.Field
 	}
+	q.DistinctOn = s.Field.DistinctOnField
 
 	// Filter
-	q, err := setFilter(q, s.Where)
+	filters, ancestor, err := getFilters(ctx, s.Where)
 	if err != nil {
 		return "", nil, err
 	}
+	q.Filters, q.Ancestor = filters, ancestor
 
 	// Order
-	if len(s.Order) > 0 {
-		for _, o := range s.Order {
-			sort := ""
-			if o.Sort == gql.DESC {
-				sort = "-"
-			}
-			q = q.Order(sort + o.PropertyName)
-		}
+	for _, o := range s.Order {
+		q.Orders = append(q.Orders, core.Order{Property: o.PropertyName, Descending: o.Sort == gql.SORT_DESC})
 	}
 
-	// Limit
+	// Limit (`LIMIT @end` or `LIMIT FIRST(@end, number)`)
 	if s.Limit != nil {
 		if s.Limit.Cursor != "" {
-			return "", nil, fmt.Errorf("cursor is not supported: %v", s.Limit.Cursor)
+			cursor, number, err := bindResultPosition(s.Limit.Cursor, params)
+			if err != nil {
+				return "", nil, err
+			}
+			if cursor != "" {
+				q.End = cursor
+			} else {
+				q.Limit = number
+			}
+		}
+		if s.Limit.Cursor == "" || s.Limit.Number > 0 {
+			q.Limit = s.Limit.Number
 		}
-		q = q.Limit(s.Limit.Number)
 	}
 
-	// Offset
+	// Offset (`OFFSET @start` or `OFFSET @start + number`)
 	if s.Offset != nil {
 		if s.Offset.Cursor != "" {
-			return "", nil, fmt.Errorf("cursor not supported: %v", s.Offset.Cursor)
+			cursor, number, err := bindResultPosition(s.Offset.Cursor, params)
+			if err != nil {
+				return "", nil, err
+			}
+			if cursor != "" {
+				q.Start = cursor
+			} else {
+				q.Offset = number
+			}
+		}
+		if s.Offset.Cursor == "" || s.Offset.Number > 0 {
+			q.Offset = s.Offset.Number
 		}
-		q = q.Offset(s.Offset.Number)
 	}
 
 	return kind, q, nil
 }
 
-func setFilter(q *datastore.Query, where []gql.ConditionExpr) (*datastore.Query, error) {
+// validateKindlessQuery checks that the query filters and sorts only by __key__
+func validateKindlessQuery(s *gql.SelectExpr) error {
+	if err := validateKindlessConditions(s.Where); err != nil {
+		return err
+	}
+	for _, o := range s.Order {
+		if !core.IsKeyValueName(o.PropertyName) {
+			return fmt.Errorf("kindless query can sort only by %s: %s", core.KeywordKey, o.PropertyName)
+		}
+	}
+	for _, f := range append(s.Field.Field, s.Field.DistinctOnField...) {
+		if !core.IsKeyValueName(f) {
+			return fmt.Errorf("kindless query can not project properties: %s", f)
+		}
+	}
+	return nil
+}
 
+func validateKindlessConditions(where []gql.ConditionExpr) error {
 	for _, c := range where {
-		switch c.GetComparator() {
-		case gql.OP_IS_NULL:
-			return nil, errors.New("sorry. 'IS NULL' is not supported") //TODO
-
-		case gql.OP_CONTAINS:
-			return nil, errors.New("sorry. 'CONTAINS' is not supported") //TODO
-
-		case gql.OP_IN:
-			return nil, errors.New("sorry. 'IN' is not supported") //TODO
-
-		case gql.OP_HAS_DESCENDANT:
-			return nil, errors.New("sorry. 'HAS DESCENDANT' is not supported") //TODO
-
-		case gql.OP_HAS_ANCESTOR:
-			if v, ok := c.GetValue().V.(gql.KeyLiteralExpr); ok {
-				var key *datastore.Key
-				for _, k := range v.KeyPath {
-					if k.Name != "" {
-						key = datastore.NameKey(k.Kind, k.Name, key)
-					} else if k.ID > 0 {
-						key = datastore.NameKey(k.Kind, k.Name, key)
-					} else {
-						return nil, fmt.Errorf("invalid ANCESTOR key %v", k)
-					}
-				}
-				q = q.Ancestor(key)
-			} else {
-				return nil, fmt.Errorf("invalid ANCESTOR value %v", c.GetValue().V)
+		if composite, ok := c.(gql.CompositeConditionExpr); ok {
+			if err := validateKindlessConditions(composite.Conditions); err != nil {
+				return err
+			}
+		} else if !core.IsKeyValueName(c.GetPropertyName()) {
+			return fmt.Errorf("kindless query can filter only by %s: %s", core.KeywordKey, c.GetPropertyName())
+		}
+	}
+	return nil
+}
+
+// getFilters converts conditions into entity filters and an ancestor key.
+// Simple conditions are converted into property filters, and conditions joined by OR into composite filters.
+func getFilters(ctx core.Context, where []gql.ConditionExpr) ([]datastore.EntityFilter, *datastore.Key, error) {
+
+	filters := make([]datastore.EntityFilter, 0, len(where))
+	var ancestor *datastore.Key
+
+	for _, c := range where {
+		if composite, ok := c.(gql.CompositeConditionExpr); ok {
+			f, err := getCompositeFilter(ctx, composite)
+			if err != nil {
+				return nil, nil, err
+			}
+			filters = append(filters, f)
+			continue
+		}
+
+		if isAncestorCondition(c) {
+			key, err := getAncestor(ctx, c)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ancestor != nil {
+				return nil, nil, errors.New("ancestor can be specified only once")
+			}
+			ancestor = key
+			continue
+		}
+
+		f, err := getPropertyFilter(ctx, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	return filters, ancestor, nil
+}
+
+// getCompositeFilter converts conditions joined by AND or OR into a composite filter
+func getCompositeFilter(ctx core.Context, c gql.CompositeConditionExpr) (datastore.EntityFilter, error) {
+
+	filters := make([]datastore.EntityFilter, 0, len(c.Conditions))
+	for _, e := range c.Conditions {
+		if composite, ok := e.(gql.CompositeConditionExpr); ok {
+			f, err := getCompositeFilter(ctx, composite)
+			if err != nil {
+				return nil, err
 			}
+			filters = append(filters, f)
+			continue
+		}
+
+		if isAncestorCondition(e) {
+			return nil, fmt.Errorf("%v can not be used with OR", e.GetComparator())
+		}
+
+		f, err := getPropertyFilter(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	if c.Operator == gql.LOGICAL_OR {
+		return datastore.OrFilter{Filters: filters}, nil
+	}
+	return datastore.AndFilter{Filters: filters}, nil
+}
+
+func isAncestorCondition(c gql.ConditionExpr) bool {
+	return c.GetComparator() == gql.OP_HAS_ANCESTOR || c.GetComparator() == gql.OP_HAS_DESCENDANT
+}
+
+// getAncestor converts `__key__ HAS ANCESTOR key` or `key HAS DESCENDANT __key__` into the ancestor key
+func getAncestor(ctx core.Context, c gql.ConditionExpr) (*datastore.Key, error) {
+	name := c.GetPropertyName()
+	if !core.IsKeyValueName(name) {
+		return nil, fmt.Errorf("%v can be used only with %s: %s", c.GetComparator(), core.KeywordKey, name)
+	}
+
+	value, err := getFilterValue(ctx, c.GetValue())
+	if err != nil {
+		return nil, err
+	}
+	key, ok := value.(*datastore.Key)
+	if !ok {
+		return nil, fmt.Errorf("invalid %v value %v", c.GetComparator(), c.GetValue().V)
+	}
+	if key.Namespace != ctx.Namespace {
+		return nil, fmt.Errorf("namespace of ancestor '%s' is different from namespace of query '%s'", key.Namespace, ctx.Namespace)
+	}
+	return key, nil
+}
+
+// getPropertyFilter converts a condition into a property filter
+func getPropertyFilter(ctx core.Context, c gql.ConditionExpr) (datastore.PropertyFilter, error) {
+
+	name := c.GetPropertyName()
+	_, backward := c.(gql.BackwardConditionExpr)
+
+	value, err := getFilterValue(ctx, c.GetValue())
+	if err != nil {
+		return datastore.PropertyFilter{}, err
+	}
+	if _, isArray := value.([]interface{}); isArray && c.GetComparator() != gql.OP_IN && c.GetComparator() != gql.OP_NOT_IN {
+		return datastore.PropertyFilter{}, fmt.Errorf("ARRAY can be used only with IN or NOT IN: %s", name)
+	}
+
+	var op string
+	switch c.GetComparator() {
+	case gql.OP_IS_NULL:
+		op, value = "=", nil
+
+	case gql.OP_CONTAINS:
+		// an array property contains the value, if one of the elements equals to the value
+		op = "="
+
+	case gql.OP_IN:
+		if backward {
+			// `value IN property` is same as `property CONTAINS value`
+			op = "="
+		} else if _, ok := value.([]interface{}); ok {
+			op = "in"
+		} else {
+			return datastore.PropertyFilter{}, fmt.Errorf("IN requires ARRAY(...): %s", name)
+		}
+
+	case gql.OP_NOT_IN:
+		if _, ok := value.([]interface{}); !ok {
+			return datastore.PropertyFilter{}, fmt.Errorf("NOT IN requires ARRAY(...): %s", name)
+		}
+		op = "not-in"
+
+	case gql.OP_EQUALS:
+		op = "="
+
+	case gql.OP_NOT_EQUALS:
+		op = "!="
+
+	case gql.OP_LESS:
+		op = "<"
+
+	case gql.OP_LESS_EQUALS:
+		op = "<="
+
+	case gql.OP_GREATER:
+		op = ">"
+
+	case gql.OP_GREATER_EQUALS:
+		op = ">="
 
-		case gql.OP_EQUALS:
-			q = q.Filter(fmt.Sprintf("%s =", c.GetPropertyName()), c.GetValue().V)
+	default:
+		return datastore.PropertyFilter{}, fmt.Errorf("unsupported comparator: %v", c.GetComparator())
+	}
+
+	// `value < property` is same as `property > value`
+	if backward {
+		op = reverseOperator(op)
+	}
+
+	return datastore.PropertyFilter{
+		FieldName: name,
+		Operator:  op,
+		Value:     value,
+	}, nil
+}
 
-		case gql.OP_LESS:
-			q = q.Filter(fmt.Sprintf("%s <", c.GetPropertyName()), c.GetValue().V)
+func reverseOperator(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	default:
+		return op
+	}
+}
 
-		case gql.OP_LESS_EQUALS:
-			q = q.Filter(fmt.Sprintf("%s <=", c.GetPropertyName()), c.GetValue().V)
+// getFilterValue converts GQL value into datastore value
+func getFilterValue(ctx core.Context, v gql.ValueExpr) (interface{}, error) {
+	switch v.Type {
+	case gql.TYPE_KEY:
+		return getKeyFromLiteral(ctx, v.V.(gql.KeyLiteralExpr))
 
-		case gql.OP_GREATER:
-			q = q.Filter(fmt.Sprintf("%s >", c.GetPropertyName()), c.GetValue().V)
+	case gql.TYPE_BLOB:
+		blob := v.V.(gql.BlobLiteralExpr).Blob
+		b, err := base64.URLEncoding.DecodeString(blob)
+		if err != nil {
+			if b, err = base64.StdEncoding.DecodeString(blob); err != nil {
+				return nil, fmt.Errorf("can not parse '%v' as base64 stings.(%v)", blob, err)
+			}
+		}
+		return b, nil
 
-		case gql.OP_GREATER_EQUALS:
-			q = q.Filter(fmt.Sprintf("%s >=", c.GetPropertyName()), c.GetValue().V)
+	case gql.TYPE_ARRAY:
+		exprs := v.V.([]gql.ValueExpr)
+		values := make([]interface{}, len(exprs))
+		for i, e := range exprs {
+			value, err := getFilterValue(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
 		}
+		return values, nil
+
+	default:
+		return v.V, nil
+	}
+}
+
+// getKeyFromLiteral converts KEY(...) into datastore key.
+// The key is in the namespace of the query unless NAMESPACE(...) is specified.
+func getKeyFromLiteral(ctx core.Context, v gql.KeyLiteralExpr) (*datastore.Key, error) {
+
+	if v.Project != "" && ctx.ProjectID != "" && v.Project != ctx.ProjectID {
+		return nil, fmt.Errorf("project of key '%s' is different from project-id '%s'", v.Project, ctx.ProjectID)
+	}
+
+	namespace := ctx.Namespace
+	if v.Namespace != "" {
+		namespace = v.Namespace
 	}
 
-	return q, nil
+	var key *datastore.Key
+	for _, k := range v.KeyPath {
+		if k.Kind == "" {
+			return nil, fmt.Errorf("kind of key is empty: %v", v)
+		}
+		if k.Name != "" {
+			key = datastore.NameKey(k.Kind, k.Name, key)
+		} else if k.ID > 0 {
+			key = datastore.IDKey(k.Kind, k.ID, key)
+		} else {
+			return nil, fmt.Errorf("id of key should be positive integer or non-empty string: %v", k)
+		}
+		key.Namespace = namespace
+	}
+	if key == nil {
+		return nil, errors.New("key path is empty")
+	}
+	return key, nil
 }
 
 func openFile(fn string) (*os.File, error) {
@@ -254,30 +571,26 @@ func getExporter(ctx core.Context, format string, style core.TypeStyle, kind str
 	// Exporter
 	switch format {
 	case core.FormatCSV:
-		return core.NewCSVExporter(writer, ',')
+		return core.NewCSVExporter(writer, ',', kind)
 	case core.FormatTSV:
-		return core.NewCSVExporter(writer, '\t')
+		return core.NewCSVExporter(writer, '\t', kind)
+	case core.FormatJSON:
+		return core.NewJSONExport(writer, style, ctx.Namespace, kind)
+	case core.FormatNDJSON:
+		return core.NewNDJSONExport(writer, style, ctx.Namespace, kind)
 	default:
 		return core.NewYAMLExport(writer, style, ctx.Namespace, kind)
 	}
 }
 
-func outputEntities(ctx core.Context, pageSize int, kind string, q *datastore.Query, exporter core.Exporter) error {
-
-	// Get Iterator
-	client, err := core.CreateDatastoreClient(ctx)
-	if err != nil {
-		return err
-	}
-
-	iter := client.Run(context.Background(), q)
+func outputIterator(iter core.Iterator, pageSize, maxEntities int, exporter core.Exporter) error {
 
 	first := true
 	keys := make([]*datastore.Key, 0)
 	entities := make([]datastore.PropertyList, 0)
 	from := 1
 	to := 1
-	for {
+	for maxEntities <= 0 || to <= maxEntities {
 		var entity datastore.PropertyList
 		key, err := iter.Next(&entity)
 		if err == iterator.Done {
@@ -302,6 +615,7 @@ func outputEntities(ctx core.Context, pageSize int, kind string, q *datastore.Qu
 				return err
 			}
 			core.Infof("%d entities ware successfully outputed. (No.%d - No.%d)\n", to-from, from, to-1)
+			printEndCursor(iter)
 			from = to
 
 			keys = make([]*datastore.Key, 0)
@@ -327,7 +641,18 @@ func outputEntities(ctx core.Context, pageSize int, kind string, q *datastore.Qu
 			return err
 		}
 		core.Infof("%d entities ware successfully outputed. (No.%d - No.%d)\n", to-from, from, to-1)
+		printEndCursor(iter)
 	}
 
 	return nil
 }
+
+// printEndCursor prints the cursor after the last output entity. Output can be resumed by --start-cursor.
+func printEndCursor(iter core.Iterator) {
+	cursor, err := iter.Cursor()
+	if err != nil {
+		core.Debugf("can not get cursor: %v\n", err)
+		return
+	}
+	core.Infof("End cursor: %s\n", cursor)
+}
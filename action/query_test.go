@@ -0,0 +1,265 @@
+package action
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/nshmura/dsio/gql"
+	"github.com/stretchr/testify/assert"
+)
+
+func filters(t *testing.T, query string) ([]datastore.EntityFilter, *datastore.Key) {
+	s, err := parseGQL(query)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	f, ancestor, err := getFilters(core.Context{}, s.Where)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return f, ancestor
+}
+
+func filtersErr(t *testing.T, query string) error {
+	s, err := parseGQL(query)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	_, _, err = getFilters(core.Context{}, s.Where)
+	return err
+}
+
+func TestFilterComparators(t *testing.T) {
+	f, ancestor := filters(t, "SELECT * FROM Book WHERE a = 1 AND b < 'abc' AND c >= true")
+	assert.Nil(t, ancestor)
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "=", Value: int64(1)},
+		datastore.PropertyFilter{FieldName: "b", Operator: "<", Value: "abc"},
+		datastore.PropertyFilter{FieldName: "c", Operator: ">=", Value: true},
+	}, f)
+
+	f, _ = filters(t, "SELECT * FROM Book WHERE 1 = a AND 'abc' < b AND true >= c")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "=", Value: int64(1)},
+		datastore.PropertyFilter{FieldName: "b", Operator: ">", Value: "abc"},
+		datastore.PropertyFilter{FieldName: "c", Operator: "<=", Value: true},
+	}, f)
+}
+
+func TestFilterIsNull(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE a IS NULL")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "=", Value: nil},
+	}, f)
+}
+
+func TestFilterContains(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE tags CONTAINS 'go'")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "tags", Operator: "=", Value: "go"},
+	}, f)
+}
+
+func TestFilterIn(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE a IN ARRAY(1, 2, 'three')")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "in", Value: []interface{}{int64(1), int64(2), "three"}},
+	}, f)
+
+	f, _ = filters(t, "SELECT * FROM Book WHERE 'go' IN tags")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "tags", Operator: "=", Value: "go"},
+	}, f)
+
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE a IN 1"))
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE a = ARRAY(1, 2)"))
+}
+
+func TestFilterNotEquals(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE a != 1 AND b NOT IN ARRAY(1, 2) AND 'x' != c")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "!=", Value: int64(1)},
+		datastore.PropertyFilter{FieldName: "b", Operator: "not-in", Value: []interface{}{int64(1), int64(2)}},
+		datastore.PropertyFilter{FieldName: "c", Operator: "!=", Value: "x"},
+	}, f)
+
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE a NOT IN 1"))
+}
+
+func TestFilterOr(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE a = 1 AND (b = 2 OR c = 3 AND d > 4)")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "=", Value: int64(1)},
+		datastore.OrFilter{Filters: []datastore.EntityFilter{
+			datastore.PropertyFilter{FieldName: "b", Operator: "=", Value: int64(2)},
+			datastore.AndFilter{Filters: []datastore.EntityFilter{
+				datastore.PropertyFilter{FieldName: "c", Operator: "=", Value: int64(3)},
+				datastore.PropertyFilter{FieldName: "d", Operator: ">", Value: int64(4)},
+			}},
+		}},
+	}, f)
+
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE a = 1 OR __key__ HAS ANCESTOR KEY(Author, 'Huxley')"))
+}
+
+func TestFilterAncestor(t *testing.T) {
+	f, ancestor := filters(t, "SELECT * FROM Book WHERE __key__ HAS ANCESTOR KEY(Author, 'Huxley', Shelf, 12)")
+	assert.Equal(t, 0, len(f))
+	assert.Equal(t, datastore.IDKey("Shelf", 12, datastore.NameKey("Author", "Huxley", nil)), ancestor)
+
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE a HAS ANCESTOR KEY(Author, 'Huxley')"))
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE __key__ HAS ANCESTOR 'Huxley'"))
+}
+
+func TestFilterDescendant(t *testing.T) {
+	f, ancestor := filters(t, "SELECT * FROM Book WHERE KEY(Author, 'Huxley') HAS DESCENDANT __key__ AND a = 1")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "a", Operator: "=", Value: int64(1)},
+	}, f)
+	assert.Equal(t, datastore.NameKey("Author", "Huxley", nil), ancestor)
+
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE KEY(Author, 'Huxley') HAS DESCENDANT a"))
+	assert.Error(t, filtersErr(t, "SELECT * FROM Book WHERE KEY(Author, 'Huxley') HAS DESCENDANT __key__ AND __key__ HAS ANCESTOR KEY(Author, 'Orwell')"))
+}
+
+func TestKindlessQuery(t *testing.T) {
+	s, err := parseGQL("SELECT * WHERE __key__ HAS ANCESTOR KEY(Author, 'Huxley') AND __key__ > KEY(Author, 'Huxley', Book, 1) ORDER BY __key__ DESC")
+	assert.Nil(t, err)
+	assert.Nil(t, validateKindlessQuery(s))
+
+	f, ancestor := filters(t, "SELECT * WHERE __key__ HAS ANCESTOR KEY(Author, 'Huxley') AND __key__ > KEY(Author, 'Huxley', Book, 1)")
+	assert.Equal(t, datastore.NameKey("Author", "Huxley", nil), ancestor)
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "__key__", Operator: ">", Value: datastore.IDKey("Book", 1, datastore.NameKey("Author", "Huxley", nil))},
+	}, f)
+
+	for _, q := range []string{
+		"SELECT * WHERE a = 1",
+		"SELECT * ORDER BY a",
+		"SELECT a WHERE __key__ HAS ANCESTOR KEY(Author, 'Huxley')",
+	} {
+		s, err := parseGQL(q)
+		assert.Nil(t, err)
+		assert.Error(t, validateKindlessQuery(s), q)
+	}
+}
+
+func TestKeyLiteral(t *testing.T) {
+	key := func(ctx core.Context, query string) (*datastore.Key, error) {
+		s, err := parseGQL(query)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return getKeyFromLiteral(ctx, s.Where[0].GetValue().V.(gql.KeyLiteralExpr))
+	}
+
+	k, err := key(core.Context{}, "SELECT * WHERE __key__ = KEY(Author, 'Huxley', Book, 1)")
+	assert.Nil(t, err)
+	assert.Equal(t, datastore.IDKey("Book", 1, datastore.NameKey("Author", "Huxley", nil)), k)
+
+	// namespace of query
+	k, err = key(core.Context{Namespace: "dev"}, "SELECT * WHERE __key__ = KEY(Book, 1)")
+	assert.Nil(t, err)
+	assert.Equal(t, "dev", k.Namespace)
+
+	// namespace of key
+	k, err = key(core.Context{Namespace: "dev"}, "SELECT * WHERE __key__ = KEY(NAMESPACE('prod'), Author, 'Huxley', Book, 1)")
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", k.Namespace)
+	assert.Equal(t, "prod", k.Parent.Namespace)
+
+	// project
+	_, err = key(core.Context{ProjectID: "sample"}, "SELECT * WHERE __key__ = KEY(PROJECT('sample'), Book, 1)")
+	assert.Nil(t, err)
+	_, err = key(core.Context{ProjectID: "sample"}, "SELECT * WHERE __key__ = KEY(PROJECT('other'), Book, 1)")
+	assert.Error(t, err)
+}
+
+func TestKeyLiteralFilter(t *testing.T) {
+	f, _ := filters(t, "SELECT * FROM Book WHERE Author = KEY(Author, 10) AND KEY(Author, 'a') < Author")
+	assert.Equal(t, []datastore.EntityFilter{
+		datastore.PropertyFilter{FieldName: "Author", Operator: "=", Value: datastore.IDKey("Author", 10, nil)},
+		datastore.PropertyFilter{FieldName: "Author", Operator: ">", Value: datastore.NameKey("Author", "a", nil)},
+	}, f)
+
+	s, err := parseGQL("SELECT * FROM Book WHERE __key__ HAS ANCESTOR KEY(NAMESPACE('prod'), Author, 10)")
+	assert.Nil(t, err)
+	_, _, err = getFilters(core.Context{Namespace: "dev"}, s.Where)
+	assert.Error(t, err)
+}
+
+func TestAggregationQuery(t *testing.T) {
+	aliases := func(query string) ([]string, error) {
+		s, err := parseGQL(query)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, aggs, err := getAggregationQuery(&core.Query{Kind: "Book"}, s.Aggregations)
+		aliases := make([]string, len(aggs))
+		for i, a := range aggs {
+			aliases[i] = a.Alias
+		}
+		return aliases, err
+	}
+
+	a, err := aliases("SELECT COUNT(*), SUM(price) AS total, AVG(price) FROM Book")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"count", "total", "avg_price"}, a)
+
+	a, err = aliases("SELECT COUNT_UP_TO(10) FROM Book")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"count_up_to"}, a)
+
+	_, err = aliases("SELECT COUNT(*), COUNT(*) FROM Book")
+	assert.Error(t, err)
+	_, err = aliases("SELECT COUNT_UP_TO(10), SUM(price) FROM Book")
+	assert.Error(t, err)
+	_, err = aliases("SELECT COUNT_UP_TO(-1) FROM Book")
+	assert.Error(t, err)
+}
+
+func TestCountUpToLimit(t *testing.T) {
+	limit := func(query string) int {
+		s, err := parseGQL(query)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, q, err := getQuery(core.Context{}, s, nil)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		q, _, err = getAggregationQuery(q, s.Aggregations)
+		assert.Nil(t, err)
+		return q.Limit
+	}
+
+	assert.Equal(t, 100, limit("SELECT COUNT_UP_TO(100) FROM Book"))
+	assert.Equal(t, 10, limit("SELECT COUNT_UP_TO(100) FROM Book LIMIT 10"))
+	assert.Equal(t, 5, limit("SELECT COUNT_UP_TO(5) FROM Book LIMIT 10"))
+}
+
+func TestRunStatements(t *testing.T) {
+	var buf bytes.Buffer
+	opt := QueryOption{Format: core.FormatYAML, Style: core.StyleScheme, PageSize: 10, FromFile: "../samples/yaml/book.yaml"}
+	storage, err := openQueryStorage(core.Context{}, opt)
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	err = runStatements(core.Context{}, storage, strings.NewReader("SELECT * FROM Book WHERE Sort = 100;\nSELECT Title FROM Book\nWHERE Sort = 200"), opt, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(buf.String(), "scheme:"))
+	assert.Contains(t, buf.String(), "\n---\n")
+	assert.Contains(t, buf.String(), "Brave New World")
+	assert.Contains(t, buf.String(), "The Old Man and the Sea")
+
+	err = runStatements(core.Context{}, storage, strings.NewReader("SELECT * FROM Book; SELECT"), opt, &buf)
+	assert.Error(t, err)
+
+	err = runStatements(core.Context{}, storage, strings.NewReader(" ; "), opt, &buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package action
+
+import (
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// backoff before the first retry. It is doubled for each retry up to retryMaxBackoff.
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 30 * time.Second
+)
+
+// isTransientError reports whether the operation may succeed by retrying,
+// e.g. contention of transactions or temporary unavailability of Datastore.
+// DeadlineExceeded and Internal may be returned after the commit was applied, so only puts of complete keys should be retried.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == datastore.ErrConcurrentTransaction {
+		return true
+	}
+
+	switch status.Code(err) {
+	case codes.Aborted, codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
+
+// retrier waits with exponential backoff and jitter until max retries or timeout
+type retrier struct {
+	maxRetries int
+	deadline   time.Time
+	retries    int
+}
+
+func newRetrier(maxRetries int, timeout time.Duration) *retrier {
+	r := &retrier{maxRetries: maxRetries}
+	if timeout > 0 {
+		r.deadline = time.Now().Add(timeout)
+	}
+	return r
+}
+
+// wait sleeps before the next retry. It returns false without sleeping if retries are exhausted.
+func (r *retrier) wait(cause error) bool {
+	if r == nil || r.retries >= r.maxRetries {
+		return false
+	}
+
+	backoff := retryInitialBackoff << uint(r.retries)
+	if backoff > retryMaxBackoff || backoff <= 0 {
+		backoff = retryMaxBackoff
+	}
+	// equal jitter: half of the backoff is random, so that parallel batches do not retry at the same time
+	sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	if !r.deadline.IsZero() && time.Now().Add(sleep).After(r.deadline) {
+		return false
+	}
+
+	r.retries++
+	core.Infof("Retrying in %v (%d/%d): %v\n", sleep.Round(time.Millisecond), r.retries, r.maxRetries, cause)
+	time.Sleep(sleep)
+	return true
+}
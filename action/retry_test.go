@@ -0,0 +1,110 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, isTransientError(status.Error(codes.Unavailable, "unavailable")))
+	assert.True(t, isTransientError(status.Error(codes.Aborted, "too much contention")))
+	assert.True(t, isTransientError(datastore.ErrConcurrentTransaction))
+
+	assert.False(t, isTransientError(nil))
+	assert.False(t, isTransientError(status.Error(codes.InvalidArgument, "invalid")))
+	assert.False(t, isTransientError(errors.New("unknown")))
+}
+
+func TestPutValidEntitiesRetry(t *testing.T) {
+	defer func(d time.Duration) { retryInitialBackoff = d }(retryInitialBackoff)
+	retryInitialBackoff = time.Millisecond
+
+	keys := []*datastore.Key{
+		datastore.IDKey("Book", 1, nil),
+		datastore.IDKey("Book", 2, nil),
+		datastore.IDKey("Book", 3, nil),
+	}
+	src := []interface{}{1, 2, 3}
+
+	// No.2 is retried with No.1, and No.3 fails permanently
+	var calls [][]*datastore.Key
+	failed, err := putValidEntities(func(keys []*datastore.Key, src []interface{}) error {
+		calls = append(calls, keys)
+		if len(calls) == 1 {
+			return datastore.MultiError{nil, status.Error(codes.Aborted, "contention"), status.Error(codes.InvalidArgument, "invalid")}
+		}
+		return nil
+	}, keys, src, newRetrier(3, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(calls))
+	assert.Equal(t, keys[:2], calls[1])
+	assert.Equal(t, 1, len(failed))
+	assert.Equal(t, 2, failed[0].index)
+
+	// all entities fail when retries are exhausted
+	calls = nil
+	failed, err = putValidEntities(func(keys []*datastore.Key, src []interface{}) error {
+		calls = append(calls, keys)
+		return status.Error(codes.Unavailable, "unavailable")
+	}, keys, src, newRetrier(2, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(calls))
+	assert.Equal(t, 3, len(failed))
+
+	// permanent error aborts without retries
+	calls = nil
+	_, err = putValidEntities(func(keys []*datastore.Key, src []interface{}) error {
+		calls = append(calls, keys)
+		return status.Error(codes.PermissionDenied, "denied")
+	}, keys, src, newRetrier(2, 0))
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(calls))
+}
+
+// timeoutStorage applies puts, but returns DeadlineExceeded for the first puts
+type timeoutStorage struct {
+	*core.MemoryStorage
+	timeouts int
+}
+
+func (s *timeoutStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	putKeys, err := s.MemoryStorage.PutMulti(ctx, keys, src)
+	if err == nil && s.timeouts > 0 {
+		s.timeouts--
+		return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	return putKeys, err
+}
+
+func TestUpsertRetryIncompleteKeys(t *testing.T) {
+	defer func(d time.Duration) { retryInitialBackoff = d }(retryInitialBackoff)
+	retryInitialBackoff = time.Millisecond
+
+	storage := &timeoutStorage{MemoryStorage: core.NewMemoryStorage(), timeouts: 2}
+	ctx := core.Context{NonInteractive: true}
+
+	entities := []datastore.Entity{
+		{Key: datastore.IncompleteKey("Book", nil), Properties: []datastore.Property{{Name: "Title", Value: "1984"}}},
+		{Key: datastore.IncompleteKey("Book", nil), Properties: []datastore.Property{{Name: "Title", Value: "Island"}}},
+		{Key: datastore.NameKey("Book", "brave", nil), Properties: []datastore.Property{{Name: "Title", Value: "Brave New World"}}},
+	}
+	summary, err := upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeUpsert, MaxRetries: 3}, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, summary.upserted)
+
+	// IDs are allocated before the first put, so retries do not create entities twice
+	keys, err := getKeys(storage, &core.Query{Kind: "Book"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(keys))
+
+	// keys in the file are not changed
+	assert.True(t, entities[0].Key.Incomplete())
+}
@@ -0,0 +1,336 @@
+package action
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nshmura/dsio/core"
+	"github.com/nshmura/dsio/gql"
+	"github.com/peterh/liner"
+)
+
+const (
+	shellPrompt         = "gql> "
+	shellContinuePrompt = "  -> "
+	shellHistoryFile    = ".dsio_history"
+)
+
+var shellCommands = []string{`\format`, `\style`, `\ns`, `\param`, `\help`, `\quit`}
+
+const shellHelp = `Enter GQL statements terminated by ";". Statements can span multiple lines.
+Commands:
+  \format <yaml|json|ndjson|csv|tsv>  change format of output
+  \style <scheme|direct|auto>          change style of output
+  \ns [<namespace>]                    change namespace. no argument means default namespace
+  \param [<name=value>]                bind a parameter. no argument shows parameters
+  \help                                show this help
+  \quit                                exit (or Ctrl-D)
+`
+
+type shell struct {
+	ctx     core.Context
+	opt     QueryOption
+	storage core.Storage // shared by statements in the session
+	writer  io.Writer
+	names   []string // kinds and properties for completion
+
+	// terminal modes before and after liner. nil if stdin is not a terminal.
+	origMode  liner.ModeApplier
+	linerMode liner.ModeApplier
+}
+
+// Shell reads GQL statements from terminal and executes them until \quit or EOF
+func Shell(ctx core.Context, opt QueryOption, writer io.Writer) error {
+
+	storage, err := openQueryStorage(ctx, opt)
+	if err != nil {
+		return err
+	}
+
+	sh := &shell{
+		ctx:     ctx,
+		opt:     opt,
+		storage: storage,
+		writer:  writer,
+	}
+	defer sh.close()
+	sh.loadNames()
+
+	origMode, origErr := liner.TerminalMode()
+	line := liner.NewLiner()
+	defer line.Close()
+	if linerMode, err := liner.TerminalMode(); origErr == nil && err == nil {
+		sh.origMode, sh.linerMode = origMode, linerMode
+	}
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(func(l string, pos int) (string, []string, string) {
+		return completeWord(l, pos, sh.candidates(l[:pos]))
+	})
+
+	// History
+	historyFile := getShellHistoryFile()
+	if f, err := os.Open(historyFile); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(historyFile); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		} else {
+			core.Debugf("can not write history: %v\n", err)
+		}
+	}()
+
+	fmt.Fprint(os.Stderr, shellHelp)
+
+	var buf []string
+	for {
+		prompt := shellPrompt
+		if len(buf) > 0 {
+			prompt = shellContinuePrompt
+		}
+
+		input, err := line.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			// Ctrl-C discards the statement in progress
+			buf = nil
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Command
+		if len(buf) == 0 && strings.HasPrefix(strings.TrimSpace(input), `\`) {
+			line.AppendHistory(input)
+			quit, err := sh.command(strings.TrimSpace(input))
+			if err != nil {
+				core.Error(err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		// Statements. Lines are joined by newlines, so that string literals which span lines are kept.
+		buf = append(buf, input)
+		statements, rest := splitStatements(strings.Join(buf, "\n"))
+		for _, s := range statements {
+			// history is saved line by line
+			line.AppendHistory(strings.Replace(s, "\n", " ", -1) + ";")
+			sh.execute(s)
+		}
+
+		buf = nil
+		if strings.TrimSpace(rest) != "" {
+			buf = []string{rest}
+		}
+	}
+}
+
+func (sh *shell) execute(statement string) {
+	// liner keeps the terminal in raw mode, which does not echo input nor read lines.
+	// The mode is restored while the statement runs, so that confirmations like paging work.
+	if sh.origMode != nil {
+		sh.origMode.ApplyMode()
+		defer sh.linerMode.ApplyMode()
+	}
+
+	if err := runQuery(sh.ctx, sh.storage, statement, sh.opt, sh.writer); err != nil {
+		core.Error(err)
+	}
+	if f, ok := sh.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+}
+
+// command executes a command like `\format csv`. It returns true to quit the shell.
+func (sh *shell) command(input string) (bool, error) {
+	fields := strings.Fields(input)
+	args := fields[1:]
+
+	switch fields[0] {
+	case `\quit`, `\q`, `\exit`:
+		return true, nil
+
+	case `\help`, `\h`, `\?`:
+		fmt.Fprint(os.Stderr, shellHelp)
+
+	case `\format`, `\f`:
+		if len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "format: %s\n", sh.opt.Format)
+			return false, nil
+		}
+		switch args[0] {
+		case core.FormatCSV, core.FormatTSV, core.FormatYAML, core.FormatJSON, core.FormatNDJSON:
+			sh.opt.Format = args[0]
+		default:
+			return false, fmt.Errorf("format should be yaml, json, ndjson, csv or tsv: %s", args[0])
+		}
+
+	case `\style`, `\s`:
+		if len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "style: %s\n", sh.opt.Style)
+			return false, nil
+		}
+		switch style := core.TypeStyle(args[0]); style {
+		case core.StyleScheme, core.StyleDirect, core.StyleAuto:
+			sh.opt.Style = style
+		default:
+			return false, fmt.Errorf("style should be scheme, direct or auto: %s", args[0])
+		}
+
+	case `\ns`, `\namespace`:
+		ctx := sh.ctx
+		ctx.Namespace = ""
+		if len(args) > 0 {
+			ctx.Namespace = args[0]
+		}
+
+		// entities in the file are loaded into the namespace
+		if sh.opt.FromFile != "" {
+			storage, err := loadFileStorage(ctx, sh.opt.FromFile)
+			if err != nil {
+				return false, err
+			}
+			sh.close()
+			sh.storage = storage
+		}
+
+		sh.ctx = ctx
+		fmt.Fprintf(os.Stderr, "namespace: %q\n", sh.ctx.Namespace)
+		sh.loadNames()
+
+	case `\param`, `\p`:
+		if len(args) == 0 {
+			for _, p := range sh.opt.Params {
+				fmt.Fprintln(os.Stderr, p)
+			}
+			return false, nil
+		}
+		param := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		if _, err := ParseParams([]string{param}); err != nil {
+			return false, err
+		}
+		sh.opt.Params = append(sh.opt.Params, param)
+
+	default:
+		return false, fmt.Errorf("unknown command: %s. \\help shows commands", fields[0])
+	}
+	return false, nil
+}
+
+func (sh *shell) close() {
+	if err := sh.storage.Close(); err != nil {
+		core.Debugf("can not close storage: %v\n", err)
+	}
+}
+
+// loadNames fetches kinds and properties in the namespace from metadata for completion
+func (sh *shell) loadNames() {
+	names, err := getMetadataNames(sh.storage, sh.ctx.Namespace)
+	if err != nil {
+		core.Debugf("can not get kinds and properties: %v\n", err)
+	}
+	sh.names = names
+}
+
+func (sh *shell) candidates(head string) []string {
+	if strings.HasPrefix(strings.TrimSpace(head), `\`) {
+		return shellCommands
+	}
+	return append(gql.Keywords(), sh.names...)
+}
+
+// getMetadataNames returns kinds and properties by `__kind__` and `__property__` queries
+func getMetadataNames(storage core.Storage, namespace string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, kind := range []string{"__kind__", "__property__"} {
+		keys, err := getKeys(storage, &core.Query{Kind: kind, Namespace: namespace})
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			// key of __property__ is a property name, and its parent is a kind name
+			for ; k != nil; k = k.Parent {
+				if k.Name != "" && !strings.HasPrefix(k.Name, "__") {
+					found[k.Name] = true
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// completeWord completes the word before the cursor by the candidates. Keywords are matched case-insensitively.
+func completeWord(line string, pos int, candidates []string) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+
+	start := strings.LastIndexAny(head, " \t(),=<>!") + 1
+	prefix := strings.ToUpper(head[start:])
+	if prefix == "" {
+		return head, nil, tail
+	}
+
+	completions := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToUpper(c), prefix) && !seen[c] {
+			seen[c] = true
+			completions = append(completions, c)
+		}
+	}
+	return head[:start], completions, tail
+}
+
+// splitStatements splits text into statements terminated by `;` outside of quotes.
+// It returns the complete statements and the rest which is not terminated yet.
+func splitStatements(text string) ([]string, string) {
+	statements := make([]string, 0)
+
+	var quote rune
+	start := 0
+	for i, ch := range text {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				// doubled quote is an escaped quote, and is handled as closing and opening
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == ';':
+			if s := strings.TrimSpace(text[start:i]); s != "" {
+				statements = append(statements, s)
+			}
+			start = i + 1
+		}
+	}
+	return statements, text[start:]
+}
+
+func getShellHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return shellHistoryFile
+	}
+	return filepath.Join(home, shellHistoryFile)
+}
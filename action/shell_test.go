@@ -0,0 +1,67 @@
+package action
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	statements, rest := splitStatements("SELECT * FROM Book; SELECT * FROM Author WHERE Name = 'a;b'; SELECT")
+	assert.Equal(t, []string{"SELECT * FROM Book", "SELECT * FROM Author WHERE Name = 'a;b'"}, statements)
+	assert.Equal(t, " SELECT", rest)
+
+	statements, rest = splitStatements("SELECT * FROM Book WHERE Title = 'It''s;'")
+	assert.Equal(t, 0, len(statements))
+	assert.Equal(t, "SELECT * FROM Book WHERE Title = 'It''s;'", rest)
+
+	statements, rest = splitStatements(";;SELECT * FROM `Book;`;")
+	assert.Equal(t, []string{"SELECT * FROM `Book;`"}, statements)
+	assert.Equal(t, "", rest)
+
+	// string literal which spans lines keeps the newline
+	statements, _ = splitStatements("SELECT * FROM Book\nWHERE Title = 'a\nb';")
+	assert.Equal(t, []string{"SELECT * FROM Book\nWHERE Title = 'a\nb'"}, statements)
+}
+
+func TestGetMetadataNames(t *testing.T) {
+	storage := core.NewMemoryStorage()
+	keys := []*datastore.Key{
+		datastore.IDKey("Book", 1, nil),
+		{Kind: "Author", ID: 1, Namespace: "dev"},
+	}
+	src := []datastore.PropertyList{
+		{{Name: "Title", Value: "1984"}},
+		{{Name: "Name", Value: "George Orwell"}},
+	}
+	_, err := storage.PutMulti(context.Background(), keys, src)
+	assert.Nil(t, err)
+
+	names, err := getMetadataNames(storage, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Book", "Title"}, names)
+
+	names, err = getMetadataNames(storage, "dev")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Author", "Name"}, names)
+}
+
+func TestCompleteWord(t *testing.T) {
+	candidates := []string{"SELECT", "FROM", "Book", "BookShelf", "Title"}
+
+	head, completions, tail := completeWord("sel", 3, candidates)
+	assert.Equal(t, "", head)
+	assert.Equal(t, []string{"SELECT"}, completions)
+	assert.Equal(t, "", tail)
+
+	head, completions, tail = completeWord("SELECT * FROM Bo WHERE", 16, candidates)
+	assert.Equal(t, "SELECT * FROM ", head)
+	assert.Equal(t, []string{"Book", "BookShelf"}, completions)
+	assert.Equal(t, " WHERE", tail)
+
+	_, completions, _ = completeWord("SELECT * FROM Book WHERE (", 26, candidates)
+	assert.Equal(t, 0, len(completions))
+}
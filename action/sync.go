@@ -0,0 +1,165 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+)
+
+type syncPlan struct {
+	creates []datastore.Entity
+	updates []datastore.Entity
+	deletes []*datastore.Key
+}
+
+// Sync entities in datastore with the file. Entities which are not in the file are deleted.
+func Sync(ctx core.Context, filename, kind, format string, batchSize int) error {
+
+	// BatchSize
+	batchSize, err := getBatchSize(batchSize)
+	if err != nil {
+		return err
+	}
+
+	// Parse
+	parser, dsEntities, err := parseFile(filename, kind, format)
+	if err != nil {
+		return err
+	}
+	schemes := uniqueSchemes(parser.Schemes())
+
+	storage, err := core.CreateStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// Existing keys
+	keys := make([]*datastore.Key, 0)
+	for _, scheme := range schemes {
+		// kindless query would delete entities of all kinds
+		if scheme.Kind == "" {
+			return errors.New("kind should be specified to sync")
+		}
+		q := &core.Query{Kind: scheme.Kind, Namespace: scheme.Namespace}
+		k, err := getKeys(storage, q)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k...)
+	}
+
+	plan, err := getSyncPlan(*dsEntities, keys)
+	if err != nil {
+		return err
+	}
+	printSyncPlan(schemes, plan)
+
+	if len(plan.creates)+len(plan.updates)+len(plan.deletes) == 0 || ctx.DryRun {
+		return nil
+	}
+
+	ok, err := core.ConfirmYesNo("Do you want to apply the changes?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	// Upsert in the same order as the file
+	if len(*dsEntities) > 0 {
+		opt := UpsertOption{BatchSize: batchSize, Mode: ModeUpsert}
+		if _, err := upsertEntities(ctx, storage, dsEntities, opt, nil, false); err != nil {
+			return err
+		}
+	}
+
+	if len(plan.deletes) > 0 {
+		if err := deleteKeys(ctx, storage, plan.deletes, batchSize, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueSchemes returns schemes which have different kind or namespace
+func uniqueSchemes(schemes []core.Scheme) []core.Scheme {
+	res := make([]core.Scheme, 0, len(schemes))
+	found := make(map[[2]string]bool)
+	for _, s := range schemes {
+		k := [2]string{s.Namespace, s.Kind}
+		if !found[k] {
+			found[k] = true
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func getSyncPlan(entities []datastore.Entity, keys []*datastore.Key) (syncPlan, error) {
+	var plan syncPlan
+
+	existing := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		existing[keyID(k)] = true
+	}
+
+	inFile := make(map[string]bool, len(entities))
+	for _, e := range entities {
+		if e.Key.Incomplete() {
+			plan.creates = append(plan.creates, e)
+			continue
+		}
+
+		k := keyID(e.Key)
+		if inFile[k] {
+			return plan, errors.New("duplicate key in file: " + core.KeyToString(e.Key))
+		}
+		inFile[k] = true
+
+		if existing[k] {
+			plan.updates = append(plan.updates, e)
+		} else {
+			plan.creates = append(plan.creates, e)
+		}
+	}
+
+	for _, k := range keys {
+		if !inFile[keyID(k)] {
+			plan.deletes = append(plan.deletes, k)
+		}
+	}
+	return plan, nil
+}
+
+func keyID(k *datastore.Key) string {
+	return k.Namespace + ":" + k.String()
+}
+
+func printSyncPlan(schemes []core.Scheme, plan syncPlan) {
+	kinds := make([]string, 0, len(schemes))
+	for _, scheme := range schemes {
+		kinds = append(kinds, fmt.Sprintf("'%s' (namespace '%s')", scheme.Kind, scheme.Namespace))
+	}
+	core.Infof("Sync plan of kind %s:\n", strings.Join(kinds, ", "))
+
+	for _, e := range plan.creates {
+		k := core.KeyToString(e.Key)
+		if e.Key.Incomplete() {
+			k = "(auto)"
+		}
+		core.Infof(" create> Key=%v\n", k)
+	}
+	for _, e := range plan.updates {
+		core.Infof(" update> Key=%v\n", core.KeyToString(e.Key))
+	}
+	for _, k := range plan.deletes {
+		core.Infof(" delete> Key=%v\n", core.KeyToString(k))
+	}
+
+	core.Infof("%d to create, %d to update, %d to delete.\n", len(plan.creates), len(plan.updates), len(plan.deletes))
+}
@@ -0,0 +1,73 @@
+package action
+
+import (
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSyncPlan(t *testing.T) {
+	devKey := func(k *datastore.Key) *datastore.Key {
+		k.Namespace = "dev"
+		return k
+	}
+
+	existing := []*datastore.Key{
+		datastore.NameKey("Book", "update", nil),
+		datastore.NameKey("Book", "delete", nil),
+		devKey(datastore.NameKey("Book", "update", nil)),
+		devKey(datastore.NameKey("Book", "namespace", nil)),
+		datastore.NameKey("Book", "child", datastore.NameKey("Author", "a", nil)),
+	}
+
+	entities := []datastore.Entity{
+		{Key: datastore.NameKey("Book", "update", nil)},
+		{Key: datastore.NameKey("Book", "create", nil)},
+		{Key: datastore.IncompleteKey("Book", nil)},
+		{Key: devKey(datastore.NameKey("Book", "update", nil))},
+		// same path in another namespace is another entity
+		{Key: datastore.NameKey("Book", "namespace", nil)},
+		// same name with another parent is another entity
+		{Key: datastore.NameKey("Book", "child", datastore.NameKey("Author", "b", nil))},
+	}
+
+	plan, err := getSyncPlan(entities, existing)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []datastore.Entity{entities[1], entities[2], entities[4], entities[5]}, plan.creates)
+	assert.Equal(t, []datastore.Entity{entities[0], entities[3]}, plan.updates)
+	assert.Equal(t, []*datastore.Key{existing[1], existing[3], existing[4]}, plan.deletes)
+}
+
+func TestGetSyncPlanEmptyFile(t *testing.T) {
+	existing := []*datastore.Key{
+		datastore.IDKey("Book", 1, nil),
+		datastore.IDKey("Book", 2, nil),
+	}
+
+	// all entities are deleted
+	plan, err := getSyncPlan(nil, existing)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plan.creates))
+	assert.Equal(t, 0, len(plan.updates))
+	assert.Equal(t, existing, plan.deletes)
+}
+
+func TestGetSyncPlanDuplicateKey(t *testing.T) {
+	entities := []datastore.Entity{
+		{Key: datastore.IDKey("Book", 1, nil)},
+		{Key: datastore.IDKey("Book", 1, nil)},
+	}
+	_, err := getSyncPlan(entities, nil)
+	assert.Error(t, err)
+
+	// entities with incomplete keys are not duplicates
+	entities = []datastore.Entity{
+		{Key: datastore.IncompleteKey("Book", nil)},
+		{Key: datastore.IncompleteKey("Book", nil)},
+	}
+	plan, err := getSyncPlan(entities, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(plan.creates))
+}
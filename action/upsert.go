@@ -4,9 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"github.com/nshmura/dsio/core"
@@ -15,96 +21,922 @@ import (
 const (
 	// MaxBatchSize The number of entities per one multi upsert operation
 	MaxBatchSize = 500
+
+	// StdinFilename is the filename to read entities from stdin
+	StdinFilename = "-"
 )
 
-// Upsert entities form yaml file to datastore
-func Upsert(ctx core.Context, filename, kind, format string, batchSize int) error {
+const (
+	// ModeUpsert inserts or overwrites entities
+	ModeUpsert = "upsert"
+	// ModeInsert writes only entities which do not exist yet
+	ModeInsert = "insert"
+	// ModeUpdate writes only entities which already exist
+	ModeUpdate = "update"
+)
 
-	// Format
-	switch format {
-	case core.FormatCSV, core.FormatTSV, core.FormatYAML:
+const (
+	// ConflictSkip skips conflicted entities in insert and update mode
+	ConflictSkip = "skip"
+	// ConflictFail treats conflicted entities as failures in insert and update mode
+	ConflictFail = "fail"
+)
+
+// errUpsertStopped is returned when the user stops upserting at the confirmation
+var errUpsertStopped = errors.New("upsert is stopped")
+
+// UpsertOption is options of Upsert
+type UpsertOption struct {
+	Kind          string
+	Format        string
+	BatchSize     int
+	Mode          string
+	OnConflict    string
+	Merge         bool
+	Concurrency   int // number of batches upserted in parallel. 0 is the same as 1.
+	MaxRetries    int
+	RetryTimeout  time.Duration
+	Resume        bool
+	CheckpointDir string // directory of checkpoint files. empty means the temporary directory.
+}
+
+type entityError struct {
+	index int
+	key   *datastore.Key
+	err   error
+}
+
+type upsertSummary struct {
+	upserted int
+	skipped  []entityError
+	failed   []entityError
+}
+
+// Upsert entities form files to datastore. filenames can include directories and glob patterns.
+func Upsert(ctx core.Context, filenames []string, opt UpsertOption) error {
+
+	// BatchSize
+	batchSize, err := getBatchSize(opt.BatchSize)
+	if err != nil {
+		return err
+	}
+	opt.BatchSize = batchSize
+
+	// Mode
+	switch opt.Mode {
+	case ModeUpsert, ModeInsert, ModeUpdate:
 		// ok
 	case "":
-		var err error
-		if format, err = detectFileFormat(filename); err != nil {
-			return errors.New("can not detect file format")
-		}
+		opt.Mode = ModeUpsert
 	default:
-		return fmt.Errorf("format should be yaml, csv or tsv. :%s", format)
+		return fmt.Errorf("mode should be upsert, insert or update. :%s", opt.Mode)
 	}
 
-	// BatchSize
-	if batchSize == 0 {
-		batchSize = MaxBatchSize
-	} else if batchSize > MaxBatchSize {
-		return fmt.Errorf("batch-size should be smaller than %d\n", MaxBatchSize)
+	switch opt.OnConflict {
+	case ConflictSkip, ConflictFail:
+		// ok
+	case "":
+		opt.OnConflict = ConflictSkip
+	default:
+		return fmt.Errorf("on-conflict should be skip or fail. :%s", opt.OnConflict)
 	}
 
-	// Parser
-	parser := getParser(format)
+	// Concurrency. 0 and 1 upsert batches one by one.
+	if opt.Concurrency < 0 {
+		return fmt.Errorf("concurrency should not be negative. :%d", opt.Concurrency)
+	}
 
-	// Read from file
-	if err := parser.ReadFile(filename); err != nil {
+	// Retry
+	if opt.MaxRetries < 0 {
+		return fmt.Errorf("max-retries should not be negative. :%d", opt.MaxRetries)
+	}
+
+	// Files
+	files, err := expandFilenames(filenames)
+	if err != nil {
 		return err
 	}
 
+	var storage core.Storage
+	if !ctx.DryRun {
+		if storage, err = core.CreateStorage(ctx); err != nil {
+			return err
+		}
+		defer storage.Close()
+	}
+
+	var total upsertSummary
+	failedFiles := make([]string, 0)
+
+	for i, filename := range files {
+		if len(files) > 1 {
+			core.Infof("[%d/%d] %s\n", i+1, len(files), filename)
+		}
+
+		summary, err := upsertFile(ctx, storage, filename, opt)
+		total.upserted += summary.upserted
+		total.skipped = append(total.skipped, summary.skipped...)
+		total.failed = append(total.failed, summary.failed...)
+
+		if err != nil {
+			if len(files) == 1 {
+				return err
+			}
+			core.Infof("%s: %v\n", filename, err)
+			failedFiles = append(failedFiles, filename)
+		}
+	}
+
+	if len(files) > 1 {
+		core.Infof("%d files: %d succeeded, %d failed. %d entities were upserted, %d skipped, %d failed.\n",
+			len(files), len(files)-len(failedFiles), len(failedFiles), total.upserted, len(total.skipped), len(total.failed))
+
+		if len(failedFiles) > 0 {
+			return fmt.Errorf("failed to upsert %d files: %s", len(failedFiles), strings.Join(failedFiles, ", "))
+		}
+	}
+	return nil
+}
+
+func upsertFile(ctx core.Context, storage core.Storage, filename string, opt UpsertOption) (upsertSummary, error) {
+
+	// entities from stdin can not be resumed
+	if filename == StdinFilename && opt.Resume {
+		return upsertSummary{}, errors.New("resume can not be used with stdin")
+	}
+
+	// NDJSON is read line by line, so that large files are not loaded into memory at once
+	if format, err := getFileFormat(filename, opt.Format); err == nil && format == core.FormatNDJSON {
+		return upsertNDJSONFile(ctx, storage, filename, opt, true)
+	}
+
 	// Parse
-	dsEntities, err := parser.Parse(kind)
+	_, dsEntities, err := parseFile(filename, opt.Kind, opt.Format)
 	if err != nil {
-		return err
+		return upsertSummary{}, err
 	}
 
 	// Upsert to datastore
-	if !ctx.DryRun {
-		client, err := core.CreateDatastoreClient(ctx)
+	if ctx.DryRun {
+		return upsertSummary{}, nil
+	}
+
+	if filename == StdinFilename {
+		return upsertEntities(ctx, storage, dsEntities, opt, nil, true)
+	}
+
+	// Checkpoint
+	cp, err := openCheckpoint(filename, opt.CheckpointDir, opt.BatchSize, getCheckpointTarget(ctx, opt), opt.Resume)
+	if err != nil {
+		return upsertSummary{}, err
+	}
+	if cp.start() > 0 {
+		core.Infof("Resuming from entity No.%d.\n", cp.start()+1)
+	}
+
+	summary, err := upsertEntities(ctx, storage, dsEntities, opt, cp, true)
+	if err == nil && cp.isComplete(len(*dsEntities)) {
+		cp.remove()
+	}
+	return summary, err
+}
+
+// upsertNDJSONFile upserts entities in the NDJSON file while reading it.
+// Entities are read and upserted by windows of batches, which are upserted in parallel with --concurrency.
+func upsertNDJSONFile(ctx core.Context, storage core.Storage, filename string, opt UpsertOption, confirm bool) (upsertSummary, error) {
+	var r io.Reader = os.Stdin
+	if filename != StdinFilename {
+		fp, err := os.Open(filename)
 		if err != nil {
-			return err
+			return upsertSummary{}, err
+		}
+		defer fp.Close()
+		r = fp
+	}
+
+	parser := core.NewNDJSONParser()
+
+	// only parse in dry run
+	if ctx.DryRun {
+		return upsertSummary{}, parser.Stream(r, opt.Kind, func(datastore.Entity) error { return nil })
+	}
+
+	var cp *checkpoint
+	if filename != StdinFilename {
+		var err error
+		if cp, err = openCheckpoint(filename, opt.CheckpointDir, opt.BatchSize, getCheckpointTarget(ctx, opt), opt.Resume); err != nil {
+			return upsertSummary{}, err
+		}
+		if cp.start() > 0 {
+			core.Infof("Resuming from entity No.%d.\n", cp.start()+1)
+		}
+	}
+
+	// the number of entities is not known before reading, so parallel batches are confirmed once here
+	concurrency := 1
+	if opt.Concurrency > 1 {
+		if confirm {
+			msg := fmt.Sprintf("Do you want to upsert entities in %s by %d parallel batches? ", filename, opt.Concurrency)
+			ok, err := core.ConfirmYesNoWithDefault(msg, true)
+			if err != nil || !ok {
+				return upsertSummary{}, err
+			}
+		}
+		concurrency = opt.Concurrency
+	}
+	size := opt.BatchSize * concurrency
+
+	var summary upsertSummary
+	window := make([]datastore.Entity, 0, size)
+	base := 0
+	upsert := func() error {
+		result, err := upsertWindow(ctx, storage, &window, base, opt, cp, confirm && concurrency == 1)
+		summary.upserted += result.upserted
+		summary.skipped = append(summary.skipped, result.skipped...)
+		summary.failed = append(summary.failed, result.failed...)
+		base += len(window)
+		window = make([]datastore.Entity, 0, size)
+		return err
+	}
+
+	err := parser.Stream(r, opt.Kind, func(e datastore.Entity) error {
+		window = append(window, e)
+		if len(window) < size {
+			return nil
+		}
+		return upsert()
+	})
+	if err == nil && len(window) > 0 {
+		err = upsert()
+	}
+	if err != nil && err != errUpsertStopped {
+		return summary, err
+	}
+
+	stopped := err == errUpsertStopped
+	if err = printUpsertSummary(summary); err == nil && !stopped && cp != nil && cp.isComplete(base) {
+		cp.remove()
+	}
+	return summary, err
+}
+
+// expandFilenames expands directories and glob patterns into files. A file matched more than once is returned only once.
+func expandFilenames(filenames []string) ([]string, error) {
+
+	files := make([]string, 0, len(filenames))
+	found := make(map[string]bool)
+	add := func(file string) {
+		if clean := filepath.Clean(file); !found[clean] {
+			found[clean] = true
+			files = append(files, file)
+		}
+	}
+	stdin := false
+	for _, filename := range filenames {
+
+		// stdin can be read only once
+		if filename == StdinFilename {
+			if stdin {
+				return nil, errors.New("stdin (-) can be specified only once")
+			}
+			stdin = true
+			files = append(files, filename)
+			continue
 		}
 
-		allPage := int(math.Ceil(float64(len(*dsEntities)) / float64(batchSize)))
-		for page := 0; page < allPage; page++ {
+		var matches []string
+		if strings.ContainsAny(filename, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(filename); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match: %s", filename)
+			}
+		} else {
+			matches = []string{filename}
+		}
 
-			from := page * batchSize
-			to := (page + 1) * batchSize
-			if to > len(*dsEntities) {
-				to = len(*dsEntities)
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(m)
+				continue
 			}
 
-			// Confirm
-			if page > 0 {
-				msg := fmt.Sprintf("Do you want to upsert more entities (No.%d - No.%d)? ", from+1, to)
-				ok, err := core.ConfirmYesNoWithDefault(msg, true)
-				if err != nil {
-					return err
+			// files in directory which have known extension
+			entries, err := ioutil.ReadDir(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if e.IsDir() {
+					continue
 				}
-				if !ok {
-					break
+				if format, err := detectFileFormat(e.Name()); err == nil && format != "" {
+					add(filepath.Join(m, e.Name()))
 				}
 			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no files to upsert")
+	}
+	return files, nil
+}
+
+func parseFile(filename, kind, format string) (core.FileParser, *[]datastore.Entity, error) {
+
+	// Format
+	format, err := getFileFormat(filename, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parser
+	parser := getParser(format)
+
+	// Read from file, or stdin if filename is `-`
+	if filename == StdinFilename {
+		err = parser.Read(os.Stdin)
+	} else {
+		err = parser.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parse
+	dsEntities, err := parser.Parse(kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parser, dsEntities, nil
+}
+
+// upsertEntities upserts entities by batches. If cp is not nil, entities which failed before the checkpoint are put again,
+// committed batches are skipped, and the checkpoint is written after each successful batch.
+func upsertEntities(ctx core.Context, storage core.Storage, dsEntities *[]datastore.Entity, opt UpsertOption, cp *checkpoint, confirm bool) (upsertSummary, error) {
+	summary, err := upsertWindow(ctx, storage, dsEntities, 0, opt, cp, confirm)
+	if err != nil && err != errUpsertStopped {
+		return summary, err
+	}
+	return summary, printUpsertSummary(summary)
+}
+
+// upsertWindow upserts entities of the file from the index `base`. base should be a multiple of the batch size.
+// Indexes in the summary and the checkpoint are indexes in the file. errUpsertStopped is returned if the user stops upserting.
+func upsertWindow(ctx core.Context, storage core.Storage, dsEntities *[]datastore.Entity, base int, opt UpsertOption, cp *checkpoint, confirm bool) (upsertSummary, error) {
+
+	if opt.Concurrency > 1 {
+		return upsertEntitiesConcurrently(ctx, storage, dsEntities, base, opt, cp, confirm)
+	}
+
+	summary, err := upsertFailures(ctx, storage, dsEntities, base, opt, cp)
+	if err != nil {
+		return summary, err
+	}
+
+	firstPage := windowStart(cp, base) / opt.BatchSize
+	allPage := int(math.Ceil(float64(len(*dsEntities)) / float64(opt.BatchSize)))
+	for page := firstPage; page < allPage; page++ {
+
+		from := page * opt.BatchSize
+		to := (page + 1) * opt.BatchSize
+		if to > len(*dsEntities) {
+			to = len(*dsEntities)
+		}
+
+		// committed by parallel upsert before resume
+		if cp.isCommitted((base + from) / opt.BatchSize) {
+			continue
+		}
+
+		// Confirm all batches except the first one from the checkpoint
+		if confirm && base+from > cp.start() {
+			msg := fmt.Sprintf("Do you want to upsert more entities (No.%d - No.%d)? ", base+from+1, base+to)
+			ok, err := core.ConfirmYesNoWithDefault(msg, true)
+			if err != nil {
+				return summary, err
+			}
+			if !ok {
+				return summary, errUpsertStopped
+			}
+		}
+
+		core.Infof("Upserting %d entities...\n", to-from)
+
+		// Upsert multi entities
+		keys, src := getKeysValues(ctx, dsEntities, from, to)
+
+		result, err := upsertBatch(storage, opt, keys, src)
+		if err != nil {
+			return summary, fmt.Errorf("Upsert error: %v\n", err)
+		}
+		summary.add(result, base+from)
+
+		core.Infof("%d entities ware upserted successfully.\n", result.upserted)
+
+		cp.commit((base+from)/opt.BatchSize, result.failed, base+from)
+	}
+
+	return summary, nil
+}
+
+// windowStart returns the index in the window from which entities are not committed yet
+func windowStart(cp *checkpoint, base int) int {
+	if start := cp.start() - base; start > 0 {
+		return start
+	}
+	return 0
+}
+
+// upsertEntitiesConcurrently upserts batches by a pool of workers. Batches are confirmed only once before upserting.
+// After a batch fails, no more batches are dispatched, and the batches in progress are waited.
+func upsertEntitiesConcurrently(ctx core.Context, storage core.Storage, dsEntities *[]datastore.Entity, base int, opt UpsertOption, cp *checkpoint, confirm bool) (upsertSummary, error) {
+
+	summary, err := upsertFailures(ctx, storage, dsEntities, base, opt, cp)
+	if err != nil {
+		return summary, err
+	}
+	total := len(*dsEntities)
+	first := windowStart(cp, base)
 
-			core.Infof("Upserting %d entities...\n", to-from)
+	// Confirm
+	if confirm && total-first > opt.BatchSize {
+		msg := fmt.Sprintf("Do you want to upsert %d entities by %d parallel batches? ", total-first, opt.Concurrency)
+		ok, err := core.ConfirmYesNoWithDefault(msg, true)
+		if err != nil {
+			return summary, err
+		}
+		if !ok {
+			return summary, errUpsertStopped
+		}
+	}
 
-			// Upsert multi entities
+	type batch struct {
+		from int
+		keys []*datastore.Key
+		src  []interface{}
+	}
+	type batchResult struct {
+		from   int
+		to     int
+		result upsertSummary
+		err    error
+	}
+
+	batches := make(chan batch)
+	results := make(chan batchResult)
+	abort := make(chan struct{})
+
+	start := time.Now()
+
+	// Workers
+	var wg sync.WaitGroup
+	for i := 0; i < opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				result, err := upsertBatch(storage, opt, b.keys, b.src)
+				results <- batchResult{from: b.from, to: b.from + len(b.keys), result: result, err: err}
+			}
+		}()
+	}
+
+	// Dispatch batches in the order of the file
+	go func() {
+		defer close(batches)
+		for from := first; from < total; from += opt.BatchSize {
+			if cp.isCommitted((base + from) / opt.BatchSize) {
+				continue
+			}
+			to := from + opt.BatchSize
+			if to > total {
+				to = total
+			}
+			core.Infof("Upserting %d entities... (No.%d - No.%d)\n", to-from, base+from+1, base+to)
 			keys, src := getKeysValues(ctx, dsEntities, from, to)
 
-			if _, err := client.PutMulti(context.Background(), keys, src); err != nil {
-				if me, ok := err.(datastore.MultiError); ok {
-					for i, e := range me {
-						if e != nil {
-							return fmt.Errorf("Upsert error(entity No.%v): %v\n", i+1, e)
-						}
-					}
-				} else {
-					return fmt.Errorf("Upsert error: %v\n", err)
+			select {
+			case batches <- batch{from: from, keys: keys, src: src}:
+			case <-abort:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		if r.err != nil {
+			if err == nil {
+				err = fmt.Errorf("Upsert error(entity No.%d - No.%d): %v\n", base+r.from+1, base+r.to, r.err)
+				close(abort)
+			}
+			continue
+		}
+		summary.add(r.result, base+r.from)
+		core.Infof("%d entities ware upserted successfully. (No.%d - No.%d)\n", r.result.upserted, base+r.from+1, base+r.to)
+
+		cp.commit((base+r.from)/opt.BatchSize, r.result.failed, base+r.from)
+	}
+	elapsed := time.Since(start)
+
+	// results of batches arrive in random order
+	sort.Slice(summary.skipped, func(i, j int) bool { return summary.skipped[i].index < summary.skipped[j].index })
+	sort.Slice(summary.failed, func(i, j int) bool { return summary.failed[i].index < summary.failed[j].index })
+
+	core.Infof("%d entities were upserted in %.1f seconds. (%.1f entities/sec)\n",
+		summary.upserted, elapsed.Seconds(), float64(summary.upserted)/math.Max(elapsed.Seconds(), 0.001))
+
+	return summary, err
+}
+
+// upsertFailures puts entities in the window from the index `base`, which failed before resume, again.
+// Entities which fail again are kept in the checkpoint.
+func upsertFailures(ctx core.Context, storage core.Storage, dsEntities *[]datastore.Entity, base int, opt UpsertOption, cp *checkpoint) (upsertSummary, error) {
+
+	var summary upsertSummary
+
+	indexes := cp.failedIndexes(base, base+len(*dsEntities))
+	if len(indexes) == 0 {
+		return summary, nil
+	}
+	core.Infof("Retrying %d entities which failed before resume.\n", len(indexes))
+
+	for from := 0; from < len(indexes); from += opt.BatchSize {
+		to := from + opt.BatchSize
+		if to > len(indexes) {
+			to = len(indexes)
+		}
+
+		entities := make([]datastore.Entity, 0, to-from)
+		for _, i := range indexes[from:to] {
+			entities = append(entities, (*dsEntities)[i-base])
+		}
+		keys, src := getKeysValues(ctx, &entities, 0, len(entities))
+
+		result, err := upsertBatch(storage, opt, keys, src)
+		if err != nil {
+			return summary, fmt.Errorf("Upsert error: %v\n", err)
+		}
+
+		// indexes in the batch to indexes in the file
+		for i := range result.skipped {
+			result.skipped[i].index = indexes[from+result.skipped[i].index]
+		}
+		for i := range result.failed {
+			result.failed[i].index = indexes[from+result.failed[i].index]
+		}
+		summary.add(result, 0)
+
+		core.Infof("%d entities ware upserted successfully.\n", result.upserted)
+
+		cp.retried(indexes[from:to], result.failed)
+	}
+	return summary, nil
+}
+
+// upsertBatch upserts a batch of entities. Indexes of the results are indexes in the batch.
+func upsertBatch(storage core.Storage, opt UpsertOption, keys []*datastore.Key, src []interface{}) (upsertSummary, error) {
+	keys, err := allocateIDs(storage, opt, keys)
+	if err != nil {
+		return upsertSummary{}, err
+	}
+
+	if opt.Mode == ModeUpsert && !opt.Merge {
+		return putEntities(storage, opt, keys, src)
+	}
+	return putEntitiesInTransaction(storage, opt, keys, src)
+}
+
+// allocateIDs returns keys in which incomplete keys are completed by allocated IDs.
+// A put which timed out may have been applied, so retrying a put of incomplete keys could create the entities twice.
+func allocateIDs(storage core.Storage, opt UpsertOption, keys []*datastore.Key) ([]*datastore.Key, error) {
+
+	incomplete := make([]*datastore.Key, 0)
+	indexes := make([]int, 0)
+	for i, k := range keys {
+		if k != nil && k.Incomplete() {
+			incomplete = append(incomplete, k)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(incomplete) == 0 {
+		return keys, nil
+	}
+
+	retry := newRetrier(opt.MaxRetries, opt.RetryTimeout)
+	for {
+		allocated, err := storage.AllocateIDs(context.Background(), incomplete)
+		if err == nil {
+			completed := append([]*datastore.Key(nil), keys...)
+			for j, i := range indexes {
+				completed[i] = allocated[j]
+			}
+			return completed, nil
+		}
+		if !isTransientError(err) || !retry.wait(err) {
+			return nil, fmt.Errorf("failed to allocate IDs: %v", err)
+		}
+	}
+}
+
+// add adds the result of the batch which starts at the index `from`
+func (summary *upsertSummary) add(result upsertSummary, from int) {
+	for _, e := range result.skipped {
+		e.index += from
+		summary.skipped = append(summary.skipped, e)
+	}
+	for _, e := range result.failed {
+		e.index += from
+		summary.failed = append(summary.failed, e)
+	}
+	summary.upserted += result.upserted
+}
+
+func putEntities(storage core.Storage, opt UpsertOption, keys []*datastore.Key, src []interface{}) (upsertSummary, error) {
+
+	var summary upsertSummary
+
+	retry := newRetrier(opt.MaxRetries, opt.RetryTimeout)
+	failed, err := putValidEntities(func(keys []*datastore.Key, src []interface{}) error {
+		_, err := storage.PutMulti(context.Background(), keys, src)
+		return err
+	}, keys, src, retry)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.failed = failed
+	summary.upserted = len(keys) - len(failed)
+	return summary, nil
+}
+
+// putEntitiesInTransaction puts entities in a transaction. The transaction is retried for transient errors,
+// and all entities fail if the retries are exhausted.
+func putEntitiesInTransaction(storage core.Storage, opt UpsertOption, keys []*datastore.Key, src []interface{}) (upsertSummary, error) {
+
+	retry := newRetrier(opt.MaxRetries, opt.RetryTimeout)
+	for {
+		summary, err := runUpsertTransaction(storage, opt, keys, src)
+		if !isTransientError(err) {
+			return summary, err
+		}
+		if !retry.wait(err) {
+			return failedSummary(keys, err), nil
+		}
+	}
+}
+
+func runUpsertTransaction(storage core.Storage, opt UpsertOption, keys []*datastore.Key, src []interface{}) (upsertSummary, error) {
+
+	var summary upsertSummary
+
+	err := storage.RunInTransaction(context.Background(), func(tx core.Transaction) error {
+		summary = upsertSummary{}
+
+		existing, exists, err := getExistingEntities(tx, keys)
+		if err != nil {
+			return err
+		}
+
+		putKeys := make([]*datastore.Key, 0, len(keys))
+		putSrc := make([]interface{}, 0, len(keys))
+		indexes := make([]int, 0, len(keys))
+
+		for i, k := range keys {
+			var conflict error
+			if opt.Mode == ModeInsert && exists[i] {
+				conflict = errors.New("entity already exists")
+			} else if opt.Mode == ModeUpdate && !exists[i] {
+				conflict = errors.New("entity does not exist")
+			}
+
+			if conflict == nil {
+				value := src[i]
+				if opt.Merge && exists[i] {
+					merged := mergeProperties(existing[i], *src[i].(*datastore.PropertyList))
+					value = &merged
 				}
+				putKeys = append(putKeys, k)
+				putSrc = append(putSrc, value)
+				indexes = append(indexes, i)
+
+			} else if opt.OnConflict == ConflictFail {
+				summary.failed = append(summary.failed, entityError{index: i, key: k, err: conflict})
+
 			} else {
-				core.Infof("%d entities ware upserted successfully.\n", len(keys))
+				summary.skipped = append(summary.skipped, entityError{index: i, key: k, err: conflict})
+			}
+		}
+
+		if len(putKeys) == 0 {
+			return nil
+		}
+
+		// puts are sent on commit, so they are retried with the transaction
+		failed, err := putValidEntities(func(keys []*datastore.Key, src []interface{}) error {
+			return tx.PutMulti(keys, src)
+		}, putKeys, putSrc, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range failed {
+			e.index = indexes[e.index]
+			summary.failed = append(summary.failed, e)
+		}
+		summary.upserted = len(putKeys) - len(failed)
+		return nil
+	})
+
+	return summary, err
+}
+
+// getExistingEntities returns entities in datastore and whether each entity exists. Entities with incomplete key never exist.
+func getExistingEntities(tx core.Transaction, keys []*datastore.Key) ([]datastore.PropertyList, []bool, error) {
+
+	entities := make([]datastore.PropertyList, len(keys))
+	exists := make([]bool, len(keys))
+
+	completeKeys := make([]*datastore.Key, 0, len(keys))
+	indexes := make([]int, 0, len(keys))
+	for i, k := range keys {
+		if !k.Incomplete() {
+			completeKeys = append(completeKeys, k)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(completeKeys) == 0 {
+		return entities, exists, nil
+	}
+
+	dst := make([]datastore.PropertyList, len(completeKeys))
+	err := tx.GetMulti(completeKeys, dst)
+	me, isMultiError := err.(datastore.MultiError)
+	if err != nil && !isMultiError {
+		return nil, nil, err
+	}
+
+	for j, i := range indexes {
+		if isMultiError && me[j] != nil {
+			if me[j] == datastore.ErrNoSuchEntity {
+				continue
+			}
+			return nil, nil, me[j]
+		}
+		entities[i] = dst[j]
+		exists[i] = true
+	}
+	return entities, exists, nil
+}
+
+// mergeProperties overlays properties on existing properties. Properties which are not in props are preserved.
+func mergeProperties(existing, props datastore.PropertyList) datastore.PropertyList {
+
+	names := make(map[string]bool, len(props))
+	for _, p := range props {
+		names[p.Name] = true
+	}
+
+	merged := make(datastore.PropertyList, 0, len(existing)+len(props))
+	for _, p := range existing {
+		if !names[p.Name] {
+			merged = append(merged, p)
+		}
+	}
+	return append(merged, props...)
+}
+
+// putValidEntities puts entities. Entities which have invalid key or value are excluded and returned as failures.
+// Entities with transient errors are retried by the retrier (nil means no retries), and fail when the retries are exhausted.
+func putValidEntities(put func([]*datastore.Key, []interface{}) error, keys []*datastore.Key, src []interface{}, retry *retrier) ([]entityError, error) {
+
+	failed := make([]entityError, 0)
+
+	indexes := make([]int, len(keys))
+	for i := range keys {
+		indexes[i] = i
+	}
+
+	for len(keys) > 0 {
+		err := put(keys, src)
+		if err == nil {
+			return failed, nil
+		}
+
+		me, ok := err.(datastore.MultiError)
+		if !ok {
+			if !isTransientError(err) {
+				return failed, err
 			}
+			if retry.wait(err) {
+				continue
+			}
+			for j := range keys {
+				failed = append(failed, entityError{index: indexes[j], key: keys[j], err: err})
+			}
+			return failed, nil
 		}
+
+		// Entities with transient errors are put again with valid entities
+		var transient error
+		validKeys := make([]*datastore.Key, 0, len(keys))
+		validSrc := make([]interface{}, 0, len(keys))
+		validIndexes := make([]int, 0, len(keys))
+		for j, e := range me {
+			if e != nil && !isTransientError(e) {
+				failed = append(failed, entityError{index: indexes[j], key: keys[j], err: e})
+				continue
+			}
+			if e != nil {
+				transient = e
+			}
+			validKeys = append(validKeys, keys[j])
+			validSrc = append(validSrc, src[j])
+			validIndexes = append(validIndexes, indexes[j])
+		}
+		if len(validKeys) == len(keys) && transient == nil {
+			return failed, err
+		}
+		if transient != nil && !retry.wait(transient) {
+			for j := range validKeys {
+				failed = append(failed, entityError{index: validIndexes[j], key: validKeys[j], err: transient})
+			}
+			return failed, nil
+		}
+		keys, src, indexes = validKeys, validSrc, validIndexes
+	}
+	return failed, nil
+}
+
+// failedSummary returns the summary in which all entities failed by the error
+func failedSummary(keys []*datastore.Key, err error) upsertSummary {
+	var summary upsertSummary
+	for i, k := range keys {
+		summary.failed = append(summary.failed, entityError{index: i, key: k, err: err})
+	}
+	return summary
+}
+
+func printUpsertSummary(summary upsertSummary) error {
+
+	if len(summary.skipped) == 0 && len(summary.failed) == 0 {
+		return nil
+	}
+
+	core.Infof("%d entities were upserted, %d skipped, %d failed.\n", summary.upserted, len(summary.skipped), len(summary.failed))
+
+	for _, e := range summary.skipped {
+		core.Infof(" skipped> entity No.%d Key=%v: %v\n", e.index+1, core.KeyToString(e.key), e.err)
+	}
+	for _, e := range summary.failed {
+		core.Infof(" failed> entity No.%d Key=%v: %v\n", e.index+1, core.KeyToString(e.key), e.err)
+	}
+
+	if len(summary.failed) > 0 {
+		return fmt.Errorf("failed to upsert %d entities", len(summary.failed))
 	}
 	return nil
 }
 
+func getFileFormat(filename, format string) (string, error) {
+	switch format {
+	case core.FormatCSV, core.FormatTSV, core.FormatYAML, core.FormatJSON, core.FormatNDJSON:
+		return format, nil
+	case "":
+		if filename == StdinFilename {
+			return "", errors.New("format should be specified to read from stdin")
+		}
+		format, err := detectFileFormat(filename)
+		if err != nil {
+			return "", errors.New("can not detect file format")
+		}
+		return format, nil
+	default:
+		return "", fmt.Errorf("format should be yaml, json, ndjson, csv or tsv. :%s", format)
+	}
+}
+
+func getBatchSize(batchSize int) (int, error) {
+	if batchSize == 0 {
+		return MaxBatchSize, nil
+	} else if batchSize > MaxBatchSize {
+		return 0, fmt.Errorf("batch-size should be smaller than %d\n", MaxBatchSize)
+	}
+	return batchSize, nil
+}
+
 func detectFileFormat(filename string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filename))
 	if ext == "" || strings.HasSuffix(ext, ".") {
@@ -113,7 +945,7 @@ func detectFileFormat(filename string) (string, error) {
 	ext = ext[1:]
 
 	switch ext {
-	case core.FormatCSV, core.FormatTSV, core.FormatYAML:
+	case core.FormatCSV, core.FormatTSV, core.FormatYAML, core.FormatJSON, core.FormatNDJSON:
 		return ext, nil
 	default:
 		return "", fmt.Errorf("unknown file extension: %s", ext)
@@ -126,6 +958,10 @@ func getParser(format string) core.FileParser {
 		return core.NewCSVParser(',')
 	case core.FormatTSV:
 		return core.NewCSVParser('\t')
+	case core.FormatJSON:
+		return core.NewJSONParser()
+	case core.FormatNDJSON:
+		return core.NewNDJSONParser()
 	default:
 		return core.NewYAMLParser()
 	}
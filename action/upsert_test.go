@@ -0,0 +1,406 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/nshmura/dsio/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFileFormat(t *testing.T) {
+	format, err := getFileFormat("book.ndjson", "")
+	assert.Nil(t, err)
+	assert.Equal(t, core.FormatNDJSON, format)
+
+	format, err = getFileFormat(StdinFilename, core.FormatCSV)
+	assert.Nil(t, err)
+	assert.Equal(t, core.FormatCSV, format)
+
+	_, err = getFileFormat(StdinFilename, "")
+	assert.Error(t, err)
+}
+
+func TestExpandFilenamesStdin(t *testing.T) {
+	files, err := expandFilenames([]string{StdinFilename})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{StdinFilename}, files)
+
+	_, err = expandFilenames([]string{StdinFilename, StdinFilename})
+	assert.Error(t, err)
+}
+
+func TestExpandFilenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.yaml", "b.csv", "c.txt", "d.json"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "sub", "e.yaml"), nil, 0644))
+
+	// files of known formats in the directory. sub directories are not expanded.
+	files, err := expandFilenames([]string{dir})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.yaml"),
+		filepath.Join(dir, "b.csv"),
+		filepath.Join(dir, "d.json"),
+	}, files)
+
+	// glob
+	files, err = expandFilenames([]string{filepath.Join(dir, "*.yaml"), filepath.Join(dir, "*", "*.yaml")})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.yaml"),
+		filepath.Join(dir, "sub", "e.yaml"),
+	}, files)
+
+	// files matched more than once are upserted once in the first order
+	files, err = expandFilenames([]string{filepath.Join(dir, "d.json"), dir, filepath.Join(dir, "*.yaml")})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "d.json"),
+		filepath.Join(dir, "a.yaml"),
+		filepath.Join(dir, "b.csv"),
+	}, files)
+
+	// no matches
+	_, err = expandFilenames([]string{filepath.Join(dir, "*.ndjson")})
+	assert.Error(t, err)
+	_, err = expandFilenames([]string{filepath.Join(dir, "none.yaml")})
+	assert.Error(t, err)
+	_, err = expandFilenames([]string{filepath.Join(dir, "sub", "none")})
+	assert.Error(t, err)
+
+	// directory which has no files to upsert
+	empty := filepath.Join(dir, "empty")
+	assert.Nil(t, os.Mkdir(empty, 0755))
+	_, err = expandFilenames([]string{empty})
+	assert.Error(t, err)
+}
+
+func TestUpsertMemoryStorage(t *testing.T) {
+	storage := core.NewMemoryStorage()
+	ctx := core.Context{NonInteractive: true}
+	key := datastore.NameKey("Book", "brave", nil)
+
+	entities := []datastore.Entity{
+		{Key: key, Properties: []datastore.Property{{Name: "Title", Value: "Brave New World"}}},
+		{Key: datastore.IncompleteKey("Book", nil), Properties: []datastore.Property{{Name: "Title", Value: "1984"}}},
+	}
+	summary, err := upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeUpsert}, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.upserted)
+
+	keys, _, err := core.GetAll(context.Background(), storage, &core.Query{Kind: "Book"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keys))
+
+	// insert mode skips the existing entity
+	entities = []datastore.Entity{
+		{Key: key, Properties: []datastore.Property{{Name: "Title", Value: "Island"}}},
+	}
+	summary, err = upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeInsert, OnConflict: ConflictSkip}, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, summary.upserted)
+	assert.Equal(t, 1, len(summary.skipped))
+
+	// merge keeps properties which are not in the file
+	entities = []datastore.Entity{
+		{Key: key, Properties: []datastore.Property{{Name: "Price", Value: int64(10)}}},
+	}
+	_, err = upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeUpsert, Merge: true}, nil, false)
+	assert.Nil(t, err)
+
+	dst := make([]datastore.PropertyList, 1)
+	assert.Nil(t, storage.GetMulti(context.Background(), []*datastore.Key{key}, dst))
+	assert.Equal(t, datastore.PropertyList{
+		{Name: "Title", Value: "Brave New World"},
+		{Name: "Price", Value: int64(10)},
+	}, dst[0])
+
+	// keys which do not exist are reported by MultiError
+	err = storage.GetMulti(context.Background(), []*datastore.Key{datastore.NameKey("Book", "none", nil)}, dst)
+	assert.Equal(t, datastore.MultiError{datastore.ErrNoSuchEntity}, err)
+}
+
+func TestUpsertFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := core.Context{NonInteractive: true, Backend: core.BackendFilePrefix + dir}
+	storage, err := core.CreateStorage(ctx)
+	assert.Nil(t, err)
+
+	_, entities, err := parseFile("../samples/yaml/book.yaml", "", "")
+	assert.Nil(t, err)
+	_, err = upsertEntities(ctx, storage, entities, UpsertOption{BatchSize: 10, Mode: ModeInsert}, nil, false)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "Book.yaml"))
+	assert.Nil(t, err)
+
+	// entities are loaded from the directory
+	storage, err = core.CreateStorage(ctx)
+	assert.Nil(t, err)
+	result, err := diffEntities(storage, *entities)
+	assert.Nil(t, err)
+	assert.Equal(t, len(*entities), result.Equal)
+
+	// the file is removed with the last entity of the kind
+	keys, err := getKeys(storage, &core.Query{Kind: "Book"})
+	assert.Nil(t, err)
+	assert.Nil(t, deleteKeys(ctx, storage, keys, 10, false))
+	_, err = os.Stat(filepath.Join(dir, "Book.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUpsertConcurrently(t *testing.T) {
+	storage := core.NewMemoryStorage()
+	ctx := core.Context{NonInteractive: true}
+
+	entities := make([]datastore.Entity, 25)
+	for i := range entities {
+		entities[i] = datastore.Entity{
+			Key:        datastore.IDKey("Book", int64(i+1), nil),
+			Properties: []datastore.Property{{Name: "No", Value: int64(i + 1)}},
+		}
+	}
+
+	// No.5 and No.17 already exist
+	existing := []datastore.Entity{entities[4], entities[16]}
+	_, err := upsertEntities(ctx, storage, &existing, UpsertOption{BatchSize: 10, Mode: ModeUpsert}, nil, false)
+	assert.Nil(t, err)
+
+	opt := UpsertOption{BatchSize: 4, Mode: ModeInsert, OnConflict: ConflictFail, Concurrency: 3}
+	summary, err := upsertEntitiesConcurrently(ctx, storage, &entities, 0, opt, nil, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 23, summary.upserted)
+	assert.Equal(t, 2, len(summary.failed))
+	assert.Equal(t, 4, summary.failed[0].index)
+	assert.Equal(t, 16, summary.failed[1].index)
+
+	keys, err := getKeys(storage, &core.Query{Kind: "Book"})
+	assert.Nil(t, err)
+	assert.Equal(t, 25, len(keys))
+}
+
+// writeNDJSON writes n entities of ManyEntities into a NDJSON file in dir
+func writeNDJSON(t *testing.T, dir string, n int) string {
+	lines := []string{`{"scheme": {"kind": "ManyEntities", "key": "Value"}}`}
+	for i := 1; i <= n; i++ {
+		lines = append(lines, fmt.Sprintf(`{"Value": %d}`, i))
+	}
+	filename := filepath.Join(dir, "many.ndjson")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	return filename
+}
+
+func TestUpsertNDJSONFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeNDJSON(t, dir, 1050)
+	ctx := core.Context{NonInteractive: true}
+
+	for _, concurrency := range []int{0, 3} {
+		storage := &parallelStorage{MemoryStorage: core.NewMemoryStorage()}
+		opt := UpsertOption{BatchSize: 100, Mode: ModeUpsert, Concurrency: concurrency, CheckpointDir: dir}
+		summary, err := upsertNDJSONFile(ctx, storage, filename, opt, false)
+		assert.Nil(t, err, concurrency)
+		assert.Equal(t, 1050, summary.upserted, concurrency)
+		assert.Equal(t, 11, storage.puts, concurrency)
+
+		keys, err := getKeys(storage, &core.Query{Kind: "ManyEntities"})
+		assert.Nil(t, err, concurrency)
+		assert.Equal(t, 1050, len(keys), concurrency)
+
+		// the checkpoint is removed after all entities are upserted
+		_, err = os.Stat(checkpointPath(dir, filename))
+		assert.True(t, os.IsNotExist(err), concurrency)
+	}
+
+	// entities which can not be parsed
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"Value": 1}`+"\n"), 0644))
+	_, err = upsertNDJSONFile(ctx, core.NewMemoryStorage(), filename, UpsertOption{BatchSize: 100, Mode: ModeUpsert, CheckpointDir: dir}, false)
+	assert.Error(t, err)
+}
+
+func TestUpsertModes(t *testing.T) {
+	storage := core.NewMemoryStorage()
+	ctx := core.Context{NonInteractive: true}
+	existing := datastore.NameKey("Book", "existing", nil)
+	missing := datastore.NameKey("Book", "missing", nil)
+
+	entities := []datastore.Entity{
+		{Key: existing, Properties: []datastore.Property{{Name: "Title", Value: "Brave New World"}}},
+	}
+	_, err := upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeUpsert}, nil, false)
+	assert.Nil(t, err)
+
+	entities = []datastore.Entity{
+		{Key: existing, Properties: []datastore.Property{{Name: "Title", Value: "Island"}}},
+		{Key: missing, Properties: []datastore.Property{{Name: "Title", Value: "1984"}}},
+		{Key: datastore.IncompleteKey("Book", nil), Properties: []datastore.Property{{Name: "Title", Value: "Animal Farm"}}},
+	}
+
+	for _, c := range []struct {
+		mode       string
+		onConflict string
+		upserted   int
+		conflicts  []int
+	}{
+		// entities with incomplete keys never exist
+		{ModeInsert, ConflictSkip, 2, []int{0}},
+		{ModeInsert, ConflictFail, 2, []int{0}},
+		{ModeUpdate, ConflictSkip, 1, []int{1, 2}},
+		{ModeUpdate, ConflictFail, 1, []int{1, 2}},
+	} {
+		name := c.mode + "/" + c.onConflict
+
+		// only the first entity exists
+		s := core.NewMemoryStorage()
+		keys, src := getKeysValues(ctx, &entities, 0, 1)
+		_, err := s.PutMulti(context.Background(), keys, src)
+		assert.Nil(t, err, name)
+
+		keys, src = getKeysValues(ctx, &entities, 0, len(entities))
+		summary, err := upsertBatch(s, UpsertOption{Mode: c.mode, OnConflict: c.onConflict}, keys, src)
+		assert.Nil(t, err, name)
+		assert.Equal(t, c.upserted, summary.upserted, name)
+
+		conflicts := summary.skipped
+		if c.onConflict == ConflictFail {
+			conflicts = summary.failed
+			assert.Equal(t, 0, len(summary.skipped), name)
+		} else {
+			assert.Equal(t, 0, len(summary.failed), name)
+		}
+		indexes := make([]int, 0, len(conflicts))
+		for _, e := range conflicts {
+			indexes = append(indexes, e.index)
+		}
+		assert.Equal(t, c.conflicts, indexes, name)
+	}
+
+	// update mode does not create new entities
+	_, err = upsertEntities(ctx, storage, &entities, UpsertOption{BatchSize: 10, Mode: ModeUpdate, OnConflict: ConflictSkip}, nil, false)
+	assert.Nil(t, err)
+	keys, err := getKeys(storage, &core.Query{Kind: "Book"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*datastore.Key{existing}, keys)
+}
+
+func TestMergeProperties(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		existing datastore.PropertyList
+		props    datastore.PropertyList
+		expected datastore.PropertyList
+	}{
+		{
+			name:     "properties not in the file are preserved",
+			existing: datastore.PropertyList{{Name: "Title", Value: "Brave New World"}, {Name: "Price", Value: int64(10)}},
+			props:    datastore.PropertyList{{Name: "Price", Value: int64(20)}},
+			expected: datastore.PropertyList{{Name: "Title", Value: "Brave New World"}, {Name: "Price", Value: int64(20)}},
+		},
+		{
+			// default values are in props after parsing, so they overwrite existing values too
+			name:     "default values overwrite existing values",
+			existing: datastore.PropertyList{{Name: "Public", Value: true}, {Name: "Title", Value: "1984"}},
+			props:    datastore.PropertyList{{Name: "Price", Value: int64(20)}, {Name: "Public", Value: false}},
+			expected: datastore.PropertyList{{Name: "Title", Value: "1984"}, {Name: "Price", Value: int64(20)}, {Name: "Public", Value: false}},
+		},
+		{
+			name:     "noindex and type follow the file",
+			existing: datastore.PropertyList{{Name: "Description", Value: "short"}},
+			props:    datastore.PropertyList{{Name: "Description", Value: []interface{}{"long"}, NoIndex: true}},
+			expected: datastore.PropertyList{{Name: "Description", Value: []interface{}{"long"}, NoIndex: true}},
+		},
+		{
+			name:     "no existing properties",
+			existing: nil,
+			props:    datastore.PropertyList{{Name: "Title", Value: "Island"}},
+			expected: datastore.PropertyList{{Name: "Title", Value: "Island"}},
+		},
+	} {
+		assert.Equal(t, c.expected, mergeProperties(c.existing, c.props), c.name)
+	}
+}
+
+// parallelStorage records the number of puts and the max number of puts in progress at once
+type parallelStorage struct {
+	*core.MemoryStorage
+	mu      sync.Mutex
+	puts    int
+	running int
+	max     int
+}
+
+func (s *parallelStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	s.mu.Lock()
+	s.puts++
+	s.running++
+	if s.running > s.max {
+		s.max = s.running
+	}
+	s.mu.Unlock()
+
+	// wait so that puts of other batches overlap if they run in parallel
+	time.Sleep(10 * time.Millisecond)
+
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+	return s.MemoryStorage.PutMulti(ctx, keys, src)
+}
+
+func TestUpsertConcurrencyOption(t *testing.T) {
+	err := Upsert(core.Context{NonInteractive: true, DryRun: true}, []string{"../samples/yaml/book.yaml"}, UpsertOption{Concurrency: -1})
+	assert.Error(t, err)
+
+	_, entities, err := parseFile("../samples/yaml/many1200.yaml", "", "")
+	assert.Nil(t, err)
+	ctx := core.Context{NonInteractive: true}
+
+	for _, c := range []struct {
+		concurrency int
+		max         int
+	}{
+		// 0 is the same as 1, and upserts batches one by one
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	} {
+		storage := &parallelStorage{MemoryStorage: core.NewMemoryStorage()}
+		opt := UpsertOption{BatchSize: 100, Mode: ModeUpsert, Concurrency: c.concurrency}
+		summary, err := upsertEntities(ctx, storage, entities, opt, nil, false)
+		assert.Nil(t, err, c.concurrency)
+		assert.Equal(t, 1200, summary.upserted, c.concurrency)
+		assert.Equal(t, 0, len(summary.failed), c.concurrency)
+		assert.Equal(t, 12, storage.puts, c.concurrency)
+		if c.max == 1 {
+			assert.Equal(t, 1, storage.max, c.concurrency)
+		} else {
+			assert.True(t, storage.max > 1 && storage.max <= c.max, c.concurrency)
+		}
+
+		keys, err := getKeys(storage, &core.Query{Kind: "ManyEntities"})
+		assert.Nil(t, err, c.concurrency)
+		assert.Equal(t, 1200, len(keys), c.concurrency)
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ExportAggregation outputs the result of an aggregation query as one record in the format.
+// names are aliases of aggregations, and values are results in the same order.
+func ExportAggregation(writer io.Writer, format string, names []string, values []interface{}) error {
+	switch format {
+	case FormatCSV:
+		return exportAggregationCSV(writer, ',', names, values)
+
+	case FormatTSV:
+		return exportAggregationCSV(writer, '\t', names, values)
+
+	case FormatJSON, FormatNDJSON:
+		result := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			result[name] = jsonValue(values[i])
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		if format == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(result)
+
+	default:
+		result := make(yaml.MapSlice, len(names))
+		for i, name := range names {
+			result[i] = yaml.MapItem{Key: name, Value: values[i]}
+		}
+
+		d, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(writer, string(d))
+		return nil
+	}
+}
+
+func exportAggregationCSV(writer io.Writer, separator rune, names []string, values []interface{}) error {
+	w := csv.NewWriter(writer)
+	w.Comma = separator
+
+	record := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			record[i] = ToString(v)
+		}
+	}
+
+	w.Write(names)
+	w.Write(record)
+	w.Flush()
+	return w.Error()
+}
@@ -1,9 +1,11 @@
 package core
 
 const (
-	FormatCSV  = "csv"
-	FormatTSV  = "tsv"
-	FormatYAML = "yaml"
+	FormatCSV    = "csv"
+	FormatTSV    = "tsv"
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
 )
 
 const CsvNoIndexKeyword = ":noindex"
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"os"
+
 	"github.com/fatih/color"
 	"github.com/urfave/cli"
 )
@@ -16,6 +18,9 @@ type Context struct {
 	NoColor            bool
 	DryRun             bool
 	Verbose            bool
+	Yes                bool
+	NonInteractive     bool
+	Backend            string
 }
 
 func SetContext(c *cli.Context) Context {
@@ -29,7 +34,10 @@ func SetContext(c *cli.Context) Context {
 		NoColor:            c.Bool("no-color"),
 		Namespace:          c.String("namespace"),
 		DryRun:             c.Bool("dry-run"),
+		Yes:                c.GlobalBool("yes") || c.Bool("yes"),
+		Backend:            c.String("backend"),
 	}
+	ctx.NonInteractive = ctx.Yes || !IsTerminal(os.Stdin)
 	return ctx
 }
 
@@ -39,7 +47,9 @@ func (ctx Context) PrintContext() {
 		Debugf("service-account-file: %v\n", ctx.ServiceAccountFile)
 		Debugf("project-id: %v\n", ctx.ProjectID)
 		Debugf("namespace: %v\n", ctx.Namespace)
+		Debugf("backend: %v\n", ctx.Backend)
 		Debugf("dry-run: %v\n", ctx.DryRun)
+		Debugf("non-interactive: %v\n", ctx.NonInteractive)
 		Debug("")
 	}
 }
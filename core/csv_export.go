@@ -15,18 +15,21 @@ import (
 type CSVExporter struct {
 	writer *csv.Writer
 	types  map[string]DatastoreType
+	kind   string
 
 	schemePropInfos []PropertyInfo
 	propInfos       []PropertyInfo
 }
 
-func NewCSVExporter(w io.Writer, separator rune) *CSVExporter {
+// NewCSVExporter returns CSV exporter. If kind is empty (kindless query), keys are output with kinds.
+func NewCSVExporter(w io.Writer, separator rune, kind string) *CSVExporter {
 
 	writer := csv.NewWriter(w)
 	writer.Comma = separator
 
 	exp := &CSVExporter{
 		writer: writer,
+		kind:   kind,
 	}
 
 	return exp
@@ -44,7 +47,9 @@ func (exp *CSVExporter) DumpScheme(keys []*datastore.Key, properties []datastore
 
 	// append key
 	headers = append(headers, KeywordKey)
-	if len(keys) > 0 {
+	if exp.kind == "" {
+		types = append(types, string(TypeArray))
+	} else if len(keys) > 0 {
 		if t, err := GetTypeOfKey(keys[0]); err != nil {
 			return err
 		} else {
@@ -83,7 +88,7 @@ func (exp *CSVExporter) DumpEntities(keys []*datastore.Key, properties []datasto
 			if err != nil {
 				return err
 			}
-			values = append([]string{KeyToString(keys[i])}, values...)
+			values = append([]string{exp.keyToString(keys[i])}, values...)
 			exp.writer.Write(values)
 		}
 	}
@@ -92,6 +97,13 @@ func (exp *CSVExporter) DumpEntities(keys []*datastore.Key, properties []datasto
 	return nil
 }
 
+func (exp *CSVExporter) keyToString(k *datastore.Key) string {
+	if exp.kind == "" {
+		return KeyPathToString(k)
+	}
+	return KeyToString(k)
+}
+
 func (exp *CSVExporter) appendPropInfos(propInfos []PropertyInfo) []PropertyInfo {
 
 	var newInfos []PropertyInfo
@@ -37,8 +37,15 @@ func (p *CSVParser) ReadFile(filename string) error {
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	r := csv.NewReader(bufio.NewReader(f))
+	return p.Read(f)
+}
+
+// Read reads names and types of properties in the first two lines, and entities in the others
+func (p *CSVParser) Read(reader io.Reader) error {
+
+	r := csv.NewReader(bufio.NewReader(reader))
 	r.Comma = p.separator
 
 	i := 0
@@ -204,3 +211,7 @@ func (p *CSVParser) Parse(kind string) (*[]datastore.Entity, error) {
 
 	return &res, nil
 }
+
+func (p *CSVParser) Schemes() []Scheme {
+	return []Scheme{p.parser.kindData.Scheme}
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+)
+
+// DatastoreStorage is Google Cloud Datastore
+type DatastoreStorage struct {
+	client *datastore.Client
+}
+
+func NewDatastoreStorage(ctx Context) (*DatastoreStorage, error) {
+	client, err := CreateDatastoreClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DatastoreStorage{client: client}, nil
+}
+
+func (s *DatastoreStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	return s.client.PutMulti(ctx, keys, src)
+}
+
+func (s *DatastoreStorage) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	return s.client.GetMulti(ctx, keys, dst)
+}
+
+func (s *DatastoreStorage) DeleteMulti(ctx context.Context, keys []*datastore.Key) error {
+	return s.client.DeleteMulti(ctx, keys)
+}
+
+func (s *DatastoreStorage) AllocateIDs(ctx context.Context, keys []*datastore.Key) ([]*datastore.Key, error) {
+	return s.client.AllocateIDs(ctx, keys)
+}
+
+func (s *DatastoreStorage) Run(ctx context.Context, q *Query) Iterator {
+	dq, err := toDatastoreQuery(q)
+	if err != nil {
+		return &errorIterator{err}
+	}
+	return &datastoreIterator{s.client.Run(ctx, dq)}
+}
+
+func (s *DatastoreStorage) RunAggregationQuery(ctx context.Context, q *Query, aggregations []Aggregation) (map[string]interface{}, error) {
+	dq, err := toDatastoreQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	aq := dq.NewAggregationQuery()
+	for _, a := range aggregations {
+		switch a.Function {
+		case AggregationCount:
+			aq = aq.WithCount(a.Alias)
+		case AggregationSum:
+			aq = aq.WithSum(a.Property, a.Alias)
+		case AggregationAvg:
+			aq = aq.WithAvg(a.Property, a.Alias)
+		default:
+			return nil, fmt.Errorf("unsupported aggregation: %s", a.Function)
+		}
+	}
+
+	result, err := s.client.RunAggregationQuery(ctx, aq)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(result))
+	for alias, v := range result {
+		values[alias] = aggregationValue(v)
+	}
+	return values, nil
+}
+
+func (s *DatastoreStorage) RunInTransaction(ctx context.Context, f func(tx Transaction) error) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return f(&datastoreTransaction{tx})
+	})
+	return err
+}
+
+func (s *DatastoreStorage) Close() error {
+	return s.client.Close()
+}
+
+// toDatastoreQuery converts the query into a query of Datastore
+func toDatastoreQuery(q *Query) (*datastore.Query, error) {
+	dq := datastore.NewQuery(q.Kind).Namespace(q.Namespace)
+
+	if q.Ancestor != nil {
+		dq = dq.Ancestor(q.Ancestor)
+	}
+	for _, f := range q.Filters {
+		if pf, ok := f.(datastore.PropertyFilter); ok {
+			dq = dq.FilterField(pf.FieldName, pf.Operator, pf.Value)
+		} else {
+			dq = dq.FilterEntity(f)
+		}
+	}
+
+	if q.KeysOnly {
+		dq = dq.KeysOnly()
+	}
+	if len(q.Projection) > 0 {
+		dq = dq.Project(q.Projection...)
+	}
+	if q.Distinct {
+		dq = dq.Distinct()
+	}
+	if len(q.DistinctOn) > 0 {
+		dq = dq.DistinctOn(q.DistinctOn...)
+	}
+
+	for _, o := range q.Orders {
+		if o.Descending {
+			dq = dq.Order("-" + o.Property)
+		} else {
+			dq = dq.Order(o.Property)
+		}
+	}
+
+	if q.Start != "" {
+		c, err := datastore.DecodeCursor(q.Start)
+		if err != nil {
+			return nil, err
+		}
+		dq = dq.Start(c)
+	}
+	if q.End != "" {
+		c, err := datastore.DecodeCursor(q.End)
+		if err != nil {
+			return nil, err
+		}
+		dq = dq.End(c)
+	}
+	if q.Offset > 0 {
+		dq = dq.Offset(q.Offset)
+	}
+	if q.Limit > 0 {
+		dq = dq.Limit(q.Limit)
+	}
+	return dq, nil
+}
+
+// aggregationValue converts a value of aggregation result into int64, float64 or nil
+func aggregationValue(v interface{}) interface{} {
+	pv, ok := v.(*datastorepb.Value)
+	if !ok || pv == nil {
+		return v
+	}
+
+	switch t := pv.ValueType.(type) {
+	case *datastorepb.Value_IntegerValue:
+		return t.IntegerValue
+	case *datastorepb.Value_DoubleValue:
+		return t.DoubleValue
+	case *datastorepb.Value_NullValue:
+		return nil
+	default:
+		return v
+	}
+}
+
+type datastoreTransaction struct {
+	tx *datastore.Transaction
+}
+
+func (t *datastoreTransaction) GetMulti(keys []*datastore.Key, dst interface{}) error {
+	return t.tx.GetMulti(keys, dst)
+}
+
+func (t *datastoreTransaction) PutMulti(keys []*datastore.Key, src interface{}) error {
+	_, err := t.tx.PutMulti(keys, src)
+	return err
+}
+
+type datastoreIterator struct {
+	iter *datastore.Iterator
+}
+
+func (it *datastoreIterator) Next(dst interface{}) (*datastore.Key, error) {
+	return it.iter.Next(dst)
+}
+
+func (it *datastoreIterator) Cursor() (string, error) {
+	c, err := it.iter.Cursor()
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// errorIterator returns the error of the query
+type errorIterator struct {
+	err error
+}
+
+func (it *errorIterator) Next(dst interface{}) (*datastore.Key, error) {
+	return nil, it.err
+}
+
+func (it *errorIterator) Cursor() (string, error) {
+	return "", it.err
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+type DiffType string
+
+const (
+	DiffAdded          = DiffType("added")
+	DiffRemoved        = DiffType("removed")
+	DiffChangedValue   = DiffType("changed-value")
+	DiffChangedType    = DiffType("changed-type")
+	DiffChangedNoIndex = DiffType("changed-noindex")
+)
+
+type EntityStatus string
+
+const (
+	StatusNew       = EntityStatus("new")
+	StatusChanged   = EntityStatus("changed")
+	StatusUnchanged = EntityStatus("unchanged")
+)
+
+type PropertyDiff struct {
+	Name       string        `json:"name"`
+	Type       DiffType      `json:"type"`
+	OldType    DatastoreType `json:"old_type,omitempty"`
+	NewType    DatastoreType `json:"new_type,omitempty"`
+	OldValue   interface{}   `json:"old_value,omitempty"`
+	NewValue   interface{}   `json:"new_value,omitempty"`
+	OldNoIndex bool          `json:"old_noindex"`
+	NewNoIndex bool          `json:"new_noindex"`
+}
+
+type EntityDiff struct {
+	Key        string         `json:"key"`
+	Status     EntityStatus   `json:"status"`
+	Properties []PropertyDiff `json:"properties,omitempty"`
+}
+
+// DiffProperties returns differences from remote properties (in datastore) to local properties (in file)
+func DiffProperties(local, remote []datastore.Property) ([]PropertyDiff, error) {
+
+	localMap := make(map[string]datastore.Property)
+	remoteMap := make(map[string]datastore.Property)
+	names := make([]string, 0)
+
+	for _, p := range local {
+		localMap[p.Name] = p
+		names = append(names, p.Name)
+	}
+	for _, p := range remote {
+		if _, ok := localMap[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		remoteMap[p.Name] = p
+	}
+	sort.Strings(names)
+
+	diffs := make([]PropertyDiff, 0)
+	for _, name := range names {
+		l, inLocal := localMap[name]
+		r, inRemote := remoteMap[name]
+
+		var lType, rType DatastoreType
+		var err error
+		if inLocal {
+			if lType, err = getDatastoreType(l.Value); err != nil {
+				return nil, err
+			}
+		}
+		if inRemote {
+			if rType, err = getDatastoreType(r.Value); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case !inRemote:
+			diffs = append(diffs, PropertyDiff{
+				Name:       name,
+				Type:       DiffAdded,
+				NewType:    lType,
+				NewValue:   DisplayValue(l.Value),
+				NewNoIndex: l.NoIndex,
+			})
+
+		case !inLocal:
+			diffs = append(diffs, PropertyDiff{
+				Name:       name,
+				Type:       DiffRemoved,
+				OldType:    rType,
+				OldValue:   DisplayValue(r.Value),
+				OldNoIndex: r.NoIndex,
+			})
+
+		default:
+			if lType != rType {
+				diffs = append(diffs, PropertyDiff{
+					Name:     name,
+					Type:     DiffChangedType,
+					OldType:  rType,
+					NewType:  lType,
+					OldValue: DisplayValue(r.Value),
+					NewValue: DisplayValue(l.Value),
+				})
+			} else if !EqualValue(l.Value, r.Value) {
+				diffs = append(diffs, PropertyDiff{
+					Name:     name,
+					Type:     DiffChangedValue,
+					OldType:  rType,
+					NewType:  lType,
+					OldValue: DisplayValue(r.Value),
+					NewValue: DisplayValue(l.Value),
+				})
+			}
+
+			if l.NoIndex != r.NoIndex {
+				diffs = append(diffs, PropertyDiff{
+					Name:       name,
+					Type:       DiffChangedNoIndex,
+					OldNoIndex: r.NoIndex,
+					NewNoIndex: l.NoIndex,
+				})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// EqualValue reports whether two property values are the same in datastore
+func EqualValue(a, b interface{}) bool {
+	switch av := a.(type) {
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+
+	case *datastore.Key:
+		bv, ok := b.(*datastore.Key)
+		return ok && equalKey(av, bv)
+
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && bytes.Equal(av, bv)
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !EqualValue(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *datastore.Entity:
+		bv, ok := b.(*datastore.Entity)
+		if !ok || av == nil || bv == nil {
+			return ok && av == bv
+		}
+		diffs, err := DiffProperties(av.Properties, bv.Properties)
+		return err == nil && len(diffs) == 0
+
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func equalKey(a, b *datastore.Key) bool {
+	for a != nil && b != nil {
+		if a.Kind != b.Kind || a.ID != b.ID || a.Name != b.Name || a.Namespace != b.Namespace {
+			return false
+		}
+		a, b = a.Parent, b.Parent
+	}
+	return a == nil && b == nil
+}
+
+// DisplayValue converts a property value to human readable value
+func DisplayValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case *datastore.Key:
+		return KeyToString(t)
+
+	case []interface{}:
+		values := make([]interface{}, len(t))
+		for i, e := range t {
+			values[i] = DisplayValue(e)
+		}
+		return values
+
+	case *datastore.Entity:
+		if t == nil {
+			return nil
+		}
+		values := make(map[string]interface{})
+		for _, p := range t.Properties {
+			values[p.Name] = DisplayValue(p.Value)
+		}
+		return values
+
+	default:
+		return v
+	}
+}
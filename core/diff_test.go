@@ -0,0 +1,161 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProperties(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		local    []datastore.Property
+		remote   []datastore.Property
+		expected []PropertyDiff
+	}{
+		{
+			name:     "unchanged",
+			local:    []datastore.Property{{Name: "Title", Value: "1984"}, {Name: "Price", Value: int64(10)}},
+			remote:   []datastore.Property{{Name: "Price", Value: int64(10)}, {Name: "Title", Value: "1984"}},
+			expected: []PropertyDiff{},
+		},
+		{
+			name:   "added",
+			local:  []datastore.Property{{Name: "Title", Value: "1984"}, {Name: "Price", Value: int64(10), NoIndex: true}},
+			remote: []datastore.Property{{Name: "Title", Value: "1984"}},
+			expected: []PropertyDiff{
+				{Name: "Price", Type: DiffAdded, NewType: TypeInteger, NewValue: int64(10), NewNoIndex: true},
+			},
+		},
+		{
+			name:   "removed",
+			local:  []datastore.Property{{Name: "Title", Value: "1984"}},
+			remote: []datastore.Property{{Name: "Title", Value: "1984"}, {Name: "Author", Value: datastore.NameKey("Author", "orwell", nil)}},
+			expected: []PropertyDiff{
+				{Name: "Author", Type: DiffRemoved, OldType: TypeKey, OldValue: KeyToString(datastore.NameKey("Author", "orwell", nil))},
+			},
+		},
+		{
+			name:   "changed value",
+			local:  []datastore.Property{{Name: "Price", Value: int64(20)}},
+			remote: []datastore.Property{{Name: "Price", Value: int64(10)}},
+			expected: []PropertyDiff{
+				{Name: "Price", Type: DiffChangedValue, OldType: TypeInteger, NewType: TypeInteger, OldValue: int64(10), NewValue: int64(20)},
+			},
+		},
+		{
+			name:   "changed type only",
+			local:  []datastore.Property{{Name: "Price", Value: float64(10)}},
+			remote: []datastore.Property{{Name: "Price", Value: int64(10)}},
+			expected: []PropertyDiff{
+				{Name: "Price", Type: DiffChangedType, OldType: TypeInteger, NewType: TypeFloat, OldValue: int64(10), NewValue: float64(10)},
+			},
+		},
+		{
+			name:   "changed noindex only",
+			local:  []datastore.Property{{Name: "Description", Value: "long", NoIndex: true}},
+			remote: []datastore.Property{{Name: "Description", Value: "long"}},
+			expected: []PropertyDiff{
+				{Name: "Description", Type: DiffChangedNoIndex, OldNoIndex: false, NewNoIndex: true},
+			},
+		},
+		{
+			name:   "changed value and noindex",
+			local:  []datastore.Property{{Name: "Description", Value: "long"}},
+			remote: []datastore.Property{{Name: "Description", Value: "short", NoIndex: true}},
+			expected: []PropertyDiff{
+				{Name: "Description", Type: DiffChangedValue, OldType: TypeString, NewType: TypeString, OldValue: "short", NewValue: "long"},
+				{Name: "Description", Type: DiffChangedNoIndex, OldNoIndex: true, NewNoIndex: false},
+			},
+		},
+		{
+			name:   "changed array",
+			local:  []datastore.Property{{Name: "Tags", Value: []interface{}{"a", "c"}}},
+			remote: []datastore.Property{{Name: "Tags", Value: []interface{}{"a", "b"}}},
+			expected: []PropertyDiff{
+				{Name: "Tags", Type: DiffChangedValue, OldType: TypeArray, NewType: TypeArray, OldValue: []interface{}{"a", "b"}, NewValue: []interface{}{"a", "c"}},
+			},
+		},
+		{
+			name: "changed nested entity",
+			local: []datastore.Property{{Name: "Publisher", Value: &datastore.Entity{
+				Properties: []datastore.Property{{Name: "Name", Value: "Chatto"}},
+			}}},
+			remote: []datastore.Property{{Name: "Publisher", Value: &datastore.Entity{
+				Properties: []datastore.Property{{Name: "Name", Value: "Secker"}},
+			}}},
+			expected: []PropertyDiff{
+				{
+					Name: "Publisher", Type: DiffChangedValue, OldType: TypeEmbed, NewType: TypeEmbed,
+					OldValue: map[string]interface{}{"Name": "Secker"},
+					NewValue: map[string]interface{}{"Name": "Chatto"},
+				},
+			},
+		},
+		{
+			// results are sorted by name
+			name:   "multiple properties",
+			local:  []datastore.Property{{Name: "B", Value: "new"}, {Name: "C", Value: true}},
+			remote: []datastore.Property{{Name: "A", Value: nil}, {Name: "B", Value: "old"}},
+			expected: []PropertyDiff{
+				{Name: "A", Type: DiffRemoved, OldType: TypeNull},
+				{Name: "B", Type: DiffChangedValue, OldType: TypeString, NewType: TypeString, OldValue: "old", NewValue: "new"},
+				{Name: "C", Type: DiffAdded, NewType: TypeBool, NewValue: true},
+			},
+		},
+	} {
+		diffs, err := DiffProperties(c.local, c.remote)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.expected, diffs, c.name)
+	}
+
+	// unsupported value
+	_, err := DiffProperties([]datastore.Property{{Name: "Bad", Value: int32(1)}}, nil)
+	assert.Error(t, err)
+}
+
+func TestEqualValue(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	parent := datastore.NameKey("Author", "orwell", nil)
+	embed := func(props ...datastore.Property) *datastore.Entity {
+		return &datastore.Entity{Properties: props}
+	}
+
+	for _, c := range []struct {
+		name  string
+		a, b  interface{}
+		equal bool
+	}{
+		{"same integer", int64(1), int64(1), true},
+		{"integer and float", int64(1), float64(1), false},
+		{"different string", "a", "b", false},
+		{"nil", nil, nil, true},
+		{"nil and string", nil, "", false},
+		{"same time in other location", time.Date(2017, 1, 1, 9, 0, 0, 0, jst), time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"different time", time.Date(2017, 1, 1, 0, 0, 0, 0, jst), time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"same key", datastore.IDKey("Book", 1, parent), datastore.IDKey("Book", 1, datastore.NameKey("Author", "orwell", nil)), true},
+		{"different parent", datastore.IDKey("Book", 1, parent), datastore.IDKey("Book", 1, nil), false},
+		{"different namespace", &datastore.Key{Kind: "Book", ID: 1, Namespace: "dev"}, datastore.IDKey("Book", 1, nil), false},
+		{"same blob", []byte("abc"), []byte("abc"), true},
+		{"different blob", []byte("abc"), []byte("abd"), false},
+		{"same array", []interface{}{int64(1), "a"}, []interface{}{int64(1), "a"}, true},
+		{"array in other order", []interface{}{int64(1), "a"}, []interface{}{"a", int64(1)}, false},
+		{"array of other length", []interface{}{int64(1)}, []interface{}{int64(1), int64(1)}, false},
+		{"array of nested values", []interface{}{parent, embed(datastore.Property{Name: "A", Value: int64(1)})},
+			[]interface{}{datastore.NameKey("Author", "orwell", nil), embed(datastore.Property{Name: "A", Value: int64(1)})}, true},
+		{"embed in other property order",
+			embed(datastore.Property{Name: "A", Value: int64(1)}, datastore.Property{Name: "B", Value: "b"}),
+			embed(datastore.Property{Name: "B", Value: "b"}, datastore.Property{Name: "A", Value: int64(1)}), true},
+		{"embed with other value",
+			embed(datastore.Property{Name: "A", Value: int64(1)}),
+			embed(datastore.Property{Name: "A", Value: int64(2)}), false},
+		{"nil embed", (*datastore.Entity)(nil), (*datastore.Entity)(nil), true},
+		{"nil and empty embed", (*datastore.Entity)(nil), embed(), false},
+		{"same geo point", datastore.GeoPoint{Lat: 35, Lng: 139}, datastore.GeoPoint{Lat: 35, Lng: 139}, true},
+	} {
+		assert.Equal(t, c.equal, EqualValue(c.a, c.b), c.name)
+		assert.Equal(t, c.equal, EqualValue(c.b, c.a), c.name)
+	}
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+)
+
+const (
+	// BackendFilePrefix is the prefix of file backend like `file:./localdb`
+	BackendFilePrefix = "file:"
+
+	fileStorageExt = ".yaml"
+)
+
+// FileStorage keeps entities in a local directory for offline development.
+// Entities of each kind are stored in `<dir>/<kind>.yaml` (or `<dir>/<namespace>/<kind>.yaml`) in direct style,
+// so that the files can also be upserted into Datastore. Queries are evaluated in memory like MemoryStorage.
+type FileStorage struct {
+	*MemoryStorage
+	dir string
+
+	// writes are serialized, so that a file is not overwritten by an older snapshot
+	writeMu sync.Mutex
+}
+
+// OpenFileStorage loads entities in the directory. The directory is created if it does not exist.
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if dir == "" {
+		return nil, errors.New("directory of file backend should be specified like file:./localdb")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStorage{
+		MemoryStorage: NewMemoryStorage(),
+		dir:           dir,
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// files are in the directory of the namespace, which is the sub-directory or dir itself for the default namespace
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if strings.Contains(rel, string(filepath.Separator)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != fileStorageExt {
+			return nil
+		}
+
+		namespace := ""
+		if d := filepath.Dir(rel); d != "." {
+			if namespace, err = url.PathUnescape(d); err != nil {
+				return fmt.Errorf("%s: invalid namespace: %v", path, err)
+			}
+		}
+		return s.load(path, namespace)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load puts entities in the file. Namespace in context is not used, since the file was written in the namespace.
+func (s *FileStorage) load(filename, namespace string) error {
+	parser := NewYAMLParser()
+	if err := parser.ReadFile(filename); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	entities, err := parser.ParseNamespace(namespace)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, e := range *entities {
+		if e.Key.Namespace != namespace {
+			return fmt.Errorf("%s: namespace of %s should be '%s'", filename, KeyToString(e.Key), namespace)
+		}
+	}
+	s.put(*entities)
+	return nil
+}
+
+func (s *FileStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	putKeys, err := s.MemoryStorage.PutMulti(ctx, keys, src)
+	if err != nil {
+		return nil, err
+	}
+	return putKeys, s.save(putKeys)
+}
+
+func (s *FileStorage) DeleteMulti(ctx context.Context, keys []*datastore.Key) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryStorage.DeleteMulti(ctx, keys); err != nil {
+		return err
+	}
+	return s.save(keys)
+}
+
+func (s *FileStorage) RunInTransaction(ctx context.Context, f func(tx Transaction) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var putKeys []*datastore.Key
+	err := s.MemoryStorage.RunInTransaction(ctx, func(tx Transaction) error {
+		putKeys = nil
+		return f(&fileTransaction{tx, &putKeys})
+	})
+	if err != nil {
+		return err
+	}
+	return s.save(putKeys)
+}
+
+// save writes files of the kinds of the keys
+func (s *FileStorage) save(keys []*datastore.Key) error {
+	saved := make(map[[2]string]bool)
+	for _, k := range keys {
+		kind := [2]string{k.Namespace, k.Kind}
+		if saved[kind] {
+			continue
+		}
+		saved[kind] = true
+
+		if err := s.saveKind(k.Namespace, k.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveKind replaces the file of the kind. The file is removed if the kind has no entities.
+func (s *FileStorage) saveKind(namespace, kind string) error {
+	filename := s.kindFilename(namespace, kind)
+
+	keys, entities := s.kindEntities(namespace, kind)
+	if len(keys) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	// write into a temporary file first, so that the file is not broken by an error
+	fp, err := ioutil.TempFile(filepath.Dir(filename), ".dsio-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fp.Name())
+
+	w := bufio.NewWriter(fp)
+	exporter := NewYAMLExport(w, StyleDirect, namespace, kind)
+	if err := exporter.DumpScheme(keys, entities); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := exporter.DumpEntities(keys, entities); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fp.Name(), filename)
+}
+
+func (s *FileStorage) kindFilename(namespace, kind string) string {
+	name := url.PathEscape(kind) + fileStorageExt
+	if namespace == "" {
+		return filepath.Join(s.dir, name)
+	}
+	return filepath.Join(s.dir, url.PathEscape(namespace), name)
+}
+
+type fileTransaction struct {
+	Transaction
+	putKeys *[]*datastore.Key
+}
+
+func (tx *fileTransaction) PutMulti(keys []*datastore.Key, src interface{}) error {
+	if err := tx.Transaction.PutMulti(keys, src); err != nil {
+		return err
+	}
+	*tx.putKeys = append(*tx.putKeys, keys...)
+	return nil
+}
+
+// fileStorageDir returns the directory of backend like `file:./localdb`
+func fileStorageDir(backend string) (string, bool) {
+	if !strings.HasPrefix(backend, BackendFilePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(backend, BackendFilePrefix), true
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsio")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(namespace string) { ctx.Namespace = namespace }(ctx.Namespace)
+	ctx.Namespace = "dev"
+
+	s, err := OpenFileStorage(dir)
+	assert.Nil(t, err)
+
+	keys := []*datastore.Key{
+		datastore.NameKey("Book", "default", nil),
+		{Kind: "Book", Name: "dev", Namespace: "dev"},
+		{Kind: "Book", Name: "prod", Namespace: "prod/eu", Parent: &datastore.Key{Kind: "Author", ID: 1, Namespace: "prod/eu"}},
+	}
+	src := []datastore.PropertyList{
+		{{Name: "Title", Value: "Brave New World"}},
+		{{Name: "Title", Value: "1984"}},
+		{{Name: "Title", Value: "Island"}},
+	}
+	_, err = s.PutMulti(context.Background(), keys, src)
+	assert.Nil(t, err)
+
+	for _, name := range []string{"Book.yaml", filepath.Join("dev", "Book.yaml"), filepath.Join("prod%2Feu", "Book.yaml")} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Nil(t, err, name)
+	}
+
+	// the namespace in context is not applied to stored files
+	ctx.Namespace = "other"
+	s, err = OpenFileStorage(dir)
+	assert.Nil(t, err)
+
+	for _, namespace := range []string{"", "dev", "prod/eu", "other"} {
+		found, _, err := GetAll(context.Background(), s, &Query{Kind: "Book", Namespace: namespace})
+		assert.Nil(t, err, namespace)
+
+		expected := make([]*datastore.Key, 0)
+		for _, k := range keys {
+			if k.Namespace == namespace {
+				expected = append(expected, k)
+			}
+		}
+		assert.Equal(t, len(expected), len(found), namespace)
+		for i := range expected {
+			assert.True(t, equalKey(expected[i], found[i]), namespace)
+		}
+	}
+
+	// a file whose scheme has another namespace than its directory
+	ctx.Namespace = ""
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Author.yaml"), []byte("scheme:\n  namespace: dev\n  kind: Author\nentities:\n  - __key__: 1\n"), 0644))
+	_, err = OpenFileStorage(dir)
+	assert.Error(t, err)
+}
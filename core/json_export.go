@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/datastore"
+)
+
+// JSONExport exports entities as JSON documents in the same shape as KindData.
+// Values are converted in the same way as YAMLExport.
+type JSONExport struct {
+	writer io.Writer
+	values *YAMLExport
+	scheme Scheme
+}
+
+func NewJSONExport(writer io.Writer, style TypeStyle, namespace, kind string) *JSONExport {
+	return &JSONExport{
+		writer: writer,
+		values: NewYAMLExport(writer, style, namespace, kind),
+	}
+}
+
+// DumpScheme keeps the scheme. It is output with each page of entities, so that each document can be parsed alone.
+func (exp *JSONExport) DumpScheme(keys []*datastore.Key, properties []datastore.PropertyList) error {
+	propInfos, err := getPropInfos(properties)
+	if err != nil {
+		return err
+	}
+
+	exp.scheme, err = exp.values.getScheme(propInfos)
+	return err
+}
+
+func (exp *JSONExport) DumpEntities(keys []*datastore.Key, properties []datastore.PropertyList) error {
+	propInfos, err := getPropInfos(properties)
+	if err != nil {
+		return err
+	}
+
+	entities, err := exp.values.getEntities(keys, properties, propInfos)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entities {
+		entities[i] = jsonEntity(e)
+	}
+
+	encoder := json.NewEncoder(exp.writer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(KindData{
+		Scheme:   exp.scheme,
+		Entities: entities,
+	})
+}
+
+// NDJSONExport exports entities as newline delimited JSON. The first line is the scheme, and the others are entities.
+type NDJSONExport struct {
+	writer io.Writer
+	values *YAMLExport
+}
+
+func NewNDJSONExport(writer io.Writer, style TypeStyle, namespace, kind string) *NDJSONExport {
+	return &NDJSONExport{
+		writer: writer,
+		values: NewYAMLExport(writer, style, namespace, kind),
+	}
+}
+
+func (exp *NDJSONExport) DumpScheme(keys []*datastore.Key, properties []datastore.PropertyList) error {
+	propInfos, err := getPropInfos(properties)
+	if err != nil {
+		return err
+	}
+
+	scheme, err := exp.values.getScheme(propInfos)
+	if err != nil {
+		return err
+	}
+	return exp.outputLine(KindData{Scheme: scheme})
+}
+
+func (exp *NDJSONExport) DumpEntities(keys []*datastore.Key, properties []datastore.PropertyList) error {
+	propInfos, err := getPropInfos(properties)
+	if err != nil {
+		return err
+	}
+
+	entities, err := exp.values.getEntities(keys, properties, propInfos)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entities {
+		if err := exp.outputLine(jsonEntity(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (exp *NDJSONExport) outputLine(value interface{}) error {
+	encoder := json.NewEncoder(exp.writer)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(value)
+}
+
+func jsonEntity(e Entity) Entity {
+	entity := make(Entity, len(e))
+	for name, v := range e {
+		entity[name] = jsonValue(v)
+	}
+	return entity
+}
+
+// jsonValue marks float values, so that floats like 1.0 are not parsed as integers
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		return jsonFloat(t)
+
+	case []float64:
+		values := make([]interface{}, len(t))
+		for i, f := range t {
+			values[i] = jsonFloat(f)
+		}
+		return values
+
+	case []interface{}:
+		values := make([]interface{}, len(t))
+		for i, e := range t {
+			values[i] = jsonValue(e)
+		}
+		return values
+
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			values[k] = jsonValue(e)
+		}
+		return values
+
+	default:
+		return v
+	}
+}
+
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(float64(f))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.ContainsAny(b, ".eE") {
+		b = append(b, ".0"...)
+	}
+	return b, nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"cloud.google.com/go/datastore"
+)
+
+type JSONParser struct {
+	parsers []*Parser
+}
+
+// jsonDocument is a document in JSON file. Same shape as yamlDocument.
+type jsonDocument struct {
+	KindData
+	Kinds []KindData `json:"kinds,omitempty"`
+}
+
+func NewJSONParser() *JSONParser {
+	return &JSONParser{
+		parsers: []*Parser{
+			{&KindData{}},
+		},
+	}
+}
+
+// ReadFile reads one or more JSON documents in the file
+func (p *JSONParser) ReadFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.Read(f)
+}
+
+// Read reads one or more JSON documents
+func (p *JSONParser) Read(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var parsers []*Parser
+	for {
+		d := &jsonDocument{}
+		if err := decoder.Decode(d); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if !d.KindData.isEmpty() {
+			kindData := d.KindData
+			normalizeKindData(&kindData)
+			parsers = append(parsers, &Parser{&kindData})
+		}
+		for i := range d.Kinds {
+			normalizeKindData(&d.Kinds[i])
+			parsers = append(parsers, &Parser{&d.Kinds[i]})
+		}
+	}
+
+	if len(parsers) > 0 {
+		p.parsers = parsers
+	}
+	return nil
+}
+
+// Parse entities of all kinds in file order
+func (p *JSONParser) Parse(kind string) (*[]datastore.Entity, error) {
+	return parseKinds(p.parsers, kind, ctx.Namespace)
+}
+
+func (p *JSONParser) Schemes() []Scheme {
+	return getSchemes(p.parsers)
+}
+
+// normalizeKindData converts decoded JSON values into the values which YAML decoder returns
+func normalizeKindData(d *KindData) {
+	for name, v := range d.Scheme.Properties {
+		d.Scheme.Properties[name] = normalizeJSONValue(v)
+	}
+	for name, v := range d.Default {
+		d.Default[name] = normalizeJSONValue(v)
+	}
+	for _, e := range d.Entities {
+		for name, v := range e {
+			e[name] = normalizeJSONValue(v)
+		}
+	}
+}
+
+func normalizeJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(t))
+		for k, e := range t {
+			m[k] = normalizeJSONValue(e)
+		}
+		return m
+
+	case []interface{}:
+		for i, e := range t {
+			t[i] = normalizeJSONValue(e)
+		}
+		return t
+
+	default:
+		return v
+	}
+}
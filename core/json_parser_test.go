@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONParserNumbers(t *testing.T) {
+	parser := NewJSONParser()
+	err := parser.Read(strings.NewReader(`{"scheme": {"kind": "Book"}, "entities": [{"Int": 1, "Float": 1.0, "Fraction": 1.5, "Big": 9007199254740993}]}`))
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(*entities))
+
+	e := (*entities)[0]
+	assert.Equal(t, int64(1), findProperty(e, "Int"))
+	assert.Equal(t, float64(1), findProperty(e, "Float"))
+	assert.Equal(t, 1.5, findProperty(e, "Fraction"))
+	// integers are not rounded by float64
+	assert.Equal(t, int64(9007199254740993), findProperty(e, "Big"))
+}
+
+func TestNDJSONParserNumbers(t *testing.T) {
+	parser := NewNDJSONParser()
+	err := parser.Read(strings.NewReader(`{"scheme": {"kind": "Book"}}
+{"Int": 1, "Float": 1.0, "Array": [2, 2.0]}
+`))
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(*entities))
+
+	e := (*entities)[0]
+	assert.Equal(t, int64(1), findProperty(e, "Int"))
+	assert.Equal(t, float64(1), findProperty(e, "Float"))
+	assert.Equal(t, []interface{}{int64(2), float64(2)}, findProperty(e, "Array"))
+}
+
+func TestNDJSONParserStream(t *testing.T) {
+	parser := NewNDJSONParser()
+	assert.Nil(t, parser.ReadFile("../samples/json/book.ndjson"))
+	expected, err := parser.Parse("")
+	assert.Nil(t, err)
+
+	// entities are the same as the ones parsed after reading all lines
+	f, err := os.Open("../samples/json/book.ndjson")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+	var entities []datastore.Entity
+	err = NewNDJSONParser().Stream(f, "", func(e datastore.Entity) error {
+		entities = append(entities, e)
+		return nil
+	})
+	assert.Nil(t, err)
+	if assert.Equal(t, len(*expected), len(entities)) {
+		for i, e := range entities {
+			// properties are in random order
+			assert.Equal(t, (*expected)[i].Key, e.Key)
+			assert.ElementsMatch(t, (*expected)[i].Properties, e.Properties)
+		}
+	}
+
+	// the error of the callback stops reading
+	stop := errors.New("stop")
+	n := 0
+	err = NewNDJSONParser().Stream(strings.NewReader("{\"scheme\": {\"kind\": \"Book\"}}\n{\"__key__\": 1}\n{\"__key__\": 2}\n"), "", func(e datastore.Entity) error {
+		n++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, n)
+
+	// kind option which is different from the file
+	err = NewNDJSONParser().Stream(strings.NewReader(`{"scheme": {"kind": "Book"}}`), "Author", func(datastore.Entity) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestJSONFloat(t *testing.T) {
+	for _, c := range []struct {
+		value    float64
+		expected string
+	}{
+		{1, "1.0"},
+		{-3, "-3.0"},
+		{1.5, "1.5"},
+		{1e21, "1e+21"},
+	} {
+		b, err := jsonFloat(c.value).MarshalJSON()
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, string(b))
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	keys, properties := roundTripEntities()
+
+	for _, format := range []string{FormatJSON, FormatNDJSON} {
+		for _, style := range []TypeStyle{StyleDirect, StyleAuto} {
+			name := format + "/" + string(style)
+
+			var buf bytes.Buffer
+			var exporter interface {
+				DumpScheme([]*datastore.Key, []datastore.PropertyList) error
+				DumpEntities([]*datastore.Key, []datastore.PropertyList) error
+			}
+			var parser FileParser
+			if format == FormatJSON {
+				exporter, parser = NewJSONExport(&buf, style, "", "Book"), NewJSONParser()
+			} else {
+				exporter, parser = NewNDJSONExport(&buf, style, "", "Book"), NewNDJSONParser()
+			}
+
+			assert.Nil(t, exporter.DumpScheme(keys, properties), name)
+			assert.Nil(t, exporter.DumpEntities(keys, properties), name)
+
+			// floats keep ".0", so that they are not parsed as integers
+			out := buf.String()
+			assert.Contains(t, out, "2.0", name)
+			assert.Contains(t, out, "3.0", name)
+			if style == StyleDirect {
+				assert.Contains(t, out, KeywordDatetime, name)
+				assert.Contains(t, out, KeywordKey, name)
+			}
+
+			assert.Nil(t, parser.Read(&buf), name)
+			entities, err := parser.Parse("")
+			assert.Nil(t, err, name)
+			if !assert.Equal(t, 1, len(*entities), name) {
+				continue
+			}
+
+			e := (*entities)[0]
+			assert.Equal(t, keys[0], e.Key, name)
+			assert.Equal(t, int64(1), findProperty(e, "Int"), name)
+			assert.Equal(t, float64(2), findProperty(e, "Float"), name)
+			assert.Equal(t, []interface{}{float64(3), 3.5}, findProperty(e, "Floats"), name)
+
+			published, ok := findProperty(e, "Published").(time.Time)
+			assert.True(t, ok, name)
+			assert.True(t, published.Equal(properties[0][4].Value.(time.Time)), name)
+
+			if style == StyleDirect {
+				assert.Equal(t, datastore.NameKey("Author", "huxley", nil), findProperty(e, "Author"), name)
+			}
+		}
+	}
+}
+
+func roundTripEntities() ([]*datastore.Key, []datastore.PropertyList) {
+	keys := []*datastore.Key{datastore.IDKey("Book", 1, nil)}
+	properties := []datastore.PropertyList{{
+		{Name: "Int", Value: int64(1)},
+		{Name: "Float", Value: float64(2)},
+		{Name: "Floats", Value: []interface{}{float64(3), 3.5}},
+		{Name: "Author", Value: datastore.NameKey("Author", "huxley", nil)},
+		{Name: "Published", Value: time.Date(1932, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}}
+	return keys, properties
+}
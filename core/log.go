@@ -3,38 +3,43 @@ package core
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/fatih/color"
 	"github.com/urfave/cli"
 )
 
 func Conform(message interface{}) {
-	fmt.Printf("%v %v", color.CyanString("[CONFIRM]"), message)
+	fmt.Fprintf(os.Stderr, "%v %v", color.CyanString("[CONFIRM]"), message)
 }
 
 func Conformf(format string, value ...interface{}) {
-	fmt.Printf("%v ", color.CyanString("[CONFIRM]"))
-	fmt.Printf(format, value...)
+	fmt.Fprintf(os.Stderr, "%v ", color.CyanString("[CONFIRM]"))
+	fmt.Fprintf(os.Stderr, format, value...)
 }
 func Info(message interface{}) {
-	fmt.Printf("%v %v\n", color.GreenString("[INFO]"), message)
+	fmt.Fprintf(os.Stderr, "%v %v\n", color.GreenString("[INFO]"), message)
 }
 
 func Infof(format string, value ...interface{}) {
-	fmt.Printf("%v ", color.GreenString("[INFO]"))
-	fmt.Printf(format, value...)
+	fmt.Fprintf(os.Stderr, "%v ", color.GreenString("[INFO]"))
+	fmt.Fprintf(os.Stderr, format, value...)
+}
+
+func Error(message interface{}) {
+	fmt.Fprintf(os.Stderr, "%v %v\n", color.RedString("[ERROR]"), message)
 }
 
 func Debug(message interface{}) {
 	if ctx.Verbose {
-		fmt.Printf("%v %v\n", color.CyanString("[DEBUG]"), message)
+		fmt.Fprintf(os.Stderr, "%v %v\n", color.CyanString("[DEBUG]"), message)
 	}
 }
 
 func Debugf(format string, value ...interface{}) {
 	if ctx.Verbose {
-		fmt.Printf("%v ", color.CyanString("[DEBUG]"))
-		fmt.Printf(format, value...)
+		fmt.Fprintf(os.Stderr, "%v ", color.CyanString("[DEBUG]"))
+		fmt.Fprintf(os.Stderr, format, value...)
 	}
 }
 
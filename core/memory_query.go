@@ -0,0 +1,432 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// evaluateQuery evaluates kind, ancestor, filters, order, projection and distinct of the query.
+// The result is not limited by offset, limit and cursors.
+func evaluateQuery(q *Query, entities []datastore.Entity) ([]*datastore.Key, []datastore.PropertyList) {
+
+	matched := make([]datastore.Entity, 0, len(entities))
+	for _, e := range entities {
+		if q.Kind != "" && e.Key.Kind != q.Kind {
+			continue
+		}
+		if q.Ancestor != nil && !hasAncestor(e.Key, q.Ancestor) {
+			continue
+		}
+		if matchFilters(e, q.Filters) {
+			matched = append(matched, e)
+		}
+	}
+
+	matched = sortEntities(matched, q.Orders)
+
+	return projectEntities(matched, q)
+}
+
+func hasAncestor(key, ancestor *datastore.Key) bool {
+	for k := key; k != nil; k = k.Parent {
+		if compareKeys(k, ancestor) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFilters(e datastore.Entity, filters []datastore.EntityFilter) bool {
+	for _, f := range filters {
+		if !matchFilter(e, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFilter(e datastore.Entity, f datastore.EntityFilter) bool {
+	switch t := f.(type) {
+	case datastore.PropertyFilter:
+		return matchPropertyFilter(e, t)
+
+	case datastore.AndFilter:
+		return matchFilters(e, t.Filters)
+
+	case datastore.OrFilter:
+		for _, c := range t.Filters {
+			if matchFilter(e, c) {
+				return true
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
+
+// matchPropertyFilter reports whether the property matches the filter.
+// Like Datastore, entities without the property (or with noindex property) do not match,
+// and an array property matches if one of the elements matches.
+func matchPropertyFilter(e datastore.Entity, f datastore.PropertyFilter) bool {
+	v, ok := getIndexedValue(e, f.FieldName)
+	if !ok {
+		return false
+	}
+
+	values := []interface{}{v}
+	if arr, ok := v.([]interface{}); ok {
+		values = arr
+	}
+
+	for _, v := range values {
+		if matchValue(v, f.Operator, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchValue(v interface{}, op string, target interface{}) bool {
+	switch op {
+	case "in", "not-in":
+		targets, _ := target.([]interface{})
+		found := false
+		for _, t := range targets {
+			if c, ok := compareValues(v, t); ok && c == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == "in")
+	}
+
+	c, ok := compareValues(v, target)
+	switch op {
+	case "=":
+		return ok && c == 0
+	case "!=":
+		return !ok || c != 0
+	case "<":
+		return ok && c < 0
+	case "<=":
+		return ok && c <= 0
+	case ">":
+		return ok && c > 0
+	case ">=":
+		return ok && c >= 0
+	default:
+		return false
+	}
+}
+
+// getIndexedValue returns value of the property. `__key__` is the key, and `a.b` is a property of embedded entity.
+func getIndexedValue(e datastore.Entity, name string) (interface{}, bool) {
+	if IsKeyValueName(name) {
+		return e.Key, true
+	}
+
+	properties := e.Properties
+	for {
+		for _, p := range properties {
+			if p.Name == name {
+				return p.Value, !p.NoIndex
+			}
+		}
+
+		// embedded entity
+		i := strings.Index(name, ".")
+		if i <= 0 {
+			return nil, false
+		}
+		var embedded *datastore.Entity
+		for _, p := range properties {
+			if p.Name == name[:i] {
+				embedded, _ = p.Value.(*datastore.Entity)
+			}
+		}
+		if embedded == nil {
+			return nil, false
+		}
+		properties, name = embedded.Properties, name[i+1:]
+	}
+}
+
+// sortEntities sorts entities by the orders and then by keys.
+// Like Datastore, entities without a sort property are excluded, and an array property is sorted by
+// the smallest element in ascending order and by the largest element in descending order.
+func sortEntities(entities []datastore.Entity, orders []Order) []datastore.Entity {
+
+	type sortable struct {
+		entity datastore.Entity
+		values []interface{}
+	}
+
+	list := make([]sortable, 0, len(entities))
+	for _, e := range entities {
+		values := make([]interface{}, 0, len(orders))
+		for _, o := range orders {
+			v, ok := getIndexedValue(e, o.Property)
+			if arr, isArray := v.([]interface{}); ok && isArray {
+				v, ok = sortValue(arr, o.Descending)
+			}
+			if !ok {
+				break
+			}
+			values = append(values, v)
+		}
+		if len(values) == len(orders) {
+			list = append(list, sortable{e, values})
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		for n, o := range orders {
+			c, _ := compareValues(list[i].values[n], list[j].values[n])
+			if c == 0 {
+				continue
+			}
+			if o.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return compareKeys(list[i].entity.Key, list[j].entity.Key) < 0
+	})
+
+	sorted := make([]datastore.Entity, len(list))
+	for i, s := range list {
+		sorted[i] = s.entity
+	}
+	return sorted
+}
+
+func sortValue(values []interface{}, desc bool) (interface{}, bool) {
+	if len(values) == 0 {
+		return nil, false
+	}
+	v := values[0]
+	for _, e := range values[1:] {
+		c, _ := compareValues(e, v)
+		if (desc && c > 0) || (!desc && c < 0) {
+			v = e
+		}
+	}
+	return v, true
+}
+
+// projectEntities applies keys-only, projection, DISTINCT and DISTINCT ON
+func projectEntities(entities []datastore.Entity, q *Query) ([]*datastore.Key, []datastore.PropertyList) {
+
+	distinctOn := q.DistinctOn
+	if q.Distinct {
+		distinctOn = q.Projection
+	}
+
+	keys := make([]*datastore.Key, 0, len(entities))
+	properties := make([]datastore.PropertyList, 0, len(entities))
+	seen := make([][]interface{}, 0)
+
+entities:
+	for _, e := range entities {
+
+		// Distinct
+		if len(distinctOn) > 0 {
+			values := make([]interface{}, len(distinctOn))
+			for i, name := range distinctOn {
+				values[i], _ = getIndexedValue(e, name)
+			}
+			for _, s := range seen {
+				if equalValues(s, values) {
+					continue entities
+				}
+			}
+			seen = append(seen, values)
+		}
+
+		// Projection
+		var pl datastore.PropertyList
+		switch {
+		case q.KeysOnly:
+			pl = datastore.PropertyList{}
+
+		case len(q.Projection) > 0:
+			for _, name := range q.Projection {
+				v, ok := getIndexedValue(e, name)
+				if !ok {
+					continue entities
+				}
+				pl = append(pl, datastore.Property{Name: name, Value: v})
+			}
+
+		default:
+			pl = datastore.PropertyList(e.Properties)
+		}
+
+		keys = append(keys, e.Key)
+		properties = append(properties, pl)
+	}
+
+	return keys, properties
+}
+
+func equalValues(a, b []interface{}) bool {
+	for i := range a {
+		if c, ok := compareValues(a[i], b[i]); !ok || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues compares two values in the order of Datastore.
+// ok is false if the values are different types, and then they are compared by the order of types.
+func compareValues(a, b interface{}) (c int, ok bool) {
+	ra, rb := valueTypeRank(a), valueTypeRank(b)
+	if ra != rb {
+		return compareInt(int64(ra), int64(rb)), false
+	}
+
+	switch av := a.(type) {
+	case nil:
+		return 0, true
+
+	case int64:
+		if bv, isInt := b.(int64); isInt {
+			return compareInt(av, bv), true
+		}
+		return compareFloat(float64(av), b.(float64)), true
+
+	case float64:
+		if bv, isInt := b.(int64); isInt {
+			return compareFloat(av, float64(bv)), true
+		}
+		return compareFloat(av, b.(float64)), true
+
+	case time.Time:
+		bv := b.(time.Time)
+		if av.Before(bv) {
+			return -1, true
+		} else if av.After(bv) {
+			return 1, true
+		}
+		return 0, true
+
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0, true
+		} else if !av {
+			return -1, true
+		}
+		return 1, true
+
+	case []byte:
+		return bytes.Compare(av, b.([]byte)), true
+
+	case string:
+		return strings.Compare(av, b.(string)), true
+
+	case *datastore.Key:
+		return compareKeys(av, b.(*datastore.Key)), true
+
+	case datastore.GeoPoint:
+		bv := b.(datastore.GeoPoint)
+		if c := compareFloat(av.Lat, bv.Lat); c != 0 {
+			return c, true
+		}
+		return compareFloat(av.Lng, bv.Lng), true
+
+	default:
+		if EqualValue(a, b) {
+			return 0, true
+		}
+		return 0, false
+	}
+}
+
+// valueTypeRank returns the order of value types in Datastore
+func valueTypeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64:
+		return 1
+	case time.Time:
+		return 2
+	case bool:
+		return 3
+	case []byte:
+		return 4
+	case string:
+		return 5
+	case *datastore.Key:
+		return 6
+	case datastore.GeoPoint:
+		return 7
+	case []interface{}:
+		return 8
+	default:
+		return 9
+	}
+}
+
+// compareKeys compares keys by their paths from the root. IDs are ordered before names.
+// Namespaces are not compared, since a query runs in a single namespace.
+func compareKeys(a, b *datastore.Key) int {
+	pa, pb := keyPath(a), keyPath(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		ka, kb := pa[i], pb[i]
+		if c := strings.Compare(ka.Kind, kb.Kind); c != 0 {
+			return c
+		}
+
+		switch {
+		case ka.Name == "" && kb.Name == "":
+			if c := compareInt(ka.ID, kb.ID); c != 0 {
+				return c
+			}
+		case ka.Name == "":
+			return -1
+		case kb.Name == "":
+			return 1
+		default:
+			if c := strings.Compare(ka.Name, kb.Name); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(int64(len(pa)), int64(len(pb)))
+}
+
+// keyPath returns the key and its ancestors from the root
+func keyPath(k *datastore.Key) []*datastore.Key {
+	path := make([]*datastore.Key, 0)
+	for ; k != nil; k = k.Parent {
+		path = append([]*datastore.Key{k}, path...)
+	}
+	return path
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,426 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const memoryCursorPrefix = "memory:"
+
+// MemoryStorage keeps entities in memory. It is used for dry runs and tests.
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	entities map[string]datastore.Entity
+	lastID   int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		entities: make(map[string]datastore.Entity),
+	}
+}
+
+func (s *MemoryStorage) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	entities, err := saveEntities(keys, src)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(entities), nil
+}
+
+func (s *MemoryStorage) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getMulti(keys, dst)
+}
+
+func (s *MemoryStorage) DeleteMulti(ctx context.Context, keys []*datastore.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range keys {
+		if k == nil || k.Incomplete() {
+			return datastore.ErrInvalidKey
+		}
+		delete(s.entities, memoryKey(k))
+	}
+	return nil
+}
+
+func (s *MemoryStorage) AllocateIDs(ctx context.Context, keys []*datastore.Key) ([]*datastore.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	allocated := make([]*datastore.Key, len(keys))
+	for i, k := range keys {
+		if k == nil || !k.Incomplete() {
+			return nil, fmt.Errorf("key should be incomplete: %v", k)
+		}
+		allocated[i] = s.allocateID(k)
+	}
+	return allocated, nil
+}
+
+func (s *MemoryStorage) Run(ctx context.Context, q *Query) Iterator {
+	s.mu.RLock()
+	entities := s.queryEntities(q)
+	s.mu.RUnlock()
+
+	keys, properties := evaluateQuery(q, entities)
+
+	// Cursors, offset and limit
+	start, err := decodeMemoryCursor(q.Start, 0)
+	if err != nil {
+		return &errorIterator{err}
+	}
+	end, err := decodeMemoryCursor(q.End, len(keys))
+	if err != nil {
+		return &errorIterator{err}
+	}
+	start += q.Offset
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+	if end > len(keys) {
+		end = len(keys)
+	}
+	if start > end {
+		start = end
+	}
+
+	return &memoryIterator{
+		keys:       keys,
+		properties: properties,
+		index:      start,
+		end:        end,
+	}
+}
+
+func (s *MemoryStorage) RunAggregationQuery(ctx context.Context, q *Query, aggregations []Aggregation) (map[string]interface{}, error) {
+
+	// aggregations use all properties of the entities
+	nested := *q
+	nested.Projection, nested.Distinct, nested.DistinctOn, nested.KeysOnly = nil, false, nil, false
+
+	keys, entities, err := GetAll(ctx, s, &nested)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(aggregations))
+	for _, a := range aggregations {
+		switch a.Function {
+		case AggregationCount:
+			result[a.Alias] = int64(len(keys))
+
+		case AggregationSum, AggregationAvg:
+			var sum float64
+			var intSum int64
+			count, isFloat := 0, false
+			for i, pl := range entities {
+				v, _ := getIndexedValue(datastore.Entity{Key: keys[i], Properties: pl}, a.Property)
+				switch t := v.(type) {
+				case int64:
+					sum += float64(t)
+					intSum += t
+				case float64:
+					sum += t
+					isFloat = true
+				default:
+					continue
+				}
+				count++
+			}
+
+			switch {
+			case a.Function == AggregationAvg && count == 0:
+				result[a.Alias] = nil
+			case a.Function == AggregationAvg:
+				result[a.Alias] = sum / float64(count)
+			case isFloat:
+				result[a.Alias] = sum
+			default:
+				result[a.Alias] = intSum
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported aggregation: %s", a.Function)
+		}
+	}
+	return result, nil
+}
+
+// RunInTransaction runs f exclusively. Puts in the transaction are applied if f returns nil.
+func (s *MemoryStorage) RunInTransaction(ctx context.Context, f func(tx Transaction) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTransaction{storage: s}
+	if err := f(tx); err != nil {
+		return err
+	}
+	s.put(tx.puts)
+	return nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// put stores the entities and returns their keys. Incomplete keys are completed with new IDs.
+func (s *MemoryStorage) put(entities []datastore.Entity) []*datastore.Key {
+	keys := make([]*datastore.Key, len(entities))
+	for i, e := range entities {
+		if e.Key.Incomplete() {
+			e.Key = s.allocateID(e.Key)
+		}
+		s.entities[memoryKey(e.Key)] = e
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+func (s *MemoryStorage) getMulti(keys []*datastore.Key, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Slice || v.Len() != len(keys) {
+		return fmt.Errorf("dst should be a slice of the same length as keys: %T", dst)
+	}
+
+	errs := make(datastore.MultiError, len(keys))
+	failed := false
+	for i, k := range keys {
+		e, ok := s.entities[memoryKey(k)]
+		if !ok {
+			errs[i], failed = datastore.ErrNoSuchEntity, true
+			continue
+		}
+		if err := loadEntity(v.Index(i), e.Properties); err != nil {
+			errs[i], failed = err, true
+		}
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// allocateID returns a complete key with an ID which is not used in the storage
+func (s *MemoryStorage) allocateID(k *datastore.Key) *datastore.Key {
+	key := *k
+	for {
+		s.lastID++
+		key.ID = s.lastID
+		if _, exists := s.entities[memoryKey(&key)]; !exists {
+			return &key
+		}
+	}
+}
+
+// queryEntities returns the entities in the namespace of the query, or metadata for `__kind__` etc.
+func (s *MemoryStorage) queryEntities(q *Query) []datastore.Entity {
+	if strings.HasPrefix(q.Kind, "__") {
+		return s.metadataEntities(q.Namespace)
+	}
+
+	entities := make([]datastore.Entity, 0, len(s.entities))
+	for _, e := range s.entities {
+		if e.Key.Namespace == q.Namespace {
+			entities = append(entities, e)
+		}
+	}
+	return entities
+}
+
+// metadataEntities returns keys of `__namespace__`, `__kind__` and `__property__` metadata
+func (s *MemoryStorage) metadataEntities(namespace string) []datastore.Entity {
+
+	namespaces := make(map[string]bool)
+	properties := make(map[string]map[string]bool)
+	for _, e := range s.entities {
+		namespaces[e.Key.Namespace] = true
+		if e.Key.Namespace != namespace {
+			continue
+		}
+		if properties[e.Key.Kind] == nil {
+			properties[e.Key.Kind] = make(map[string]bool)
+		}
+		for _, p := range e.Properties {
+			properties[e.Key.Kind][p.Name] = true
+		}
+	}
+
+	entities := make([]datastore.Entity, 0)
+	for ns := range namespaces {
+		// the default namespace is ID 1
+		key := &datastore.Key{Kind: "__namespace__", Name: ns, Namespace: namespace}
+		if ns == "" {
+			key.ID = 1
+		}
+		entities = append(entities, datastore.Entity{Key: key})
+	}
+	for kind, names := range properties {
+		kindKey := &datastore.Key{Kind: "__kind__", Name: kind, Namespace: namespace}
+		entities = append(entities, datastore.Entity{Key: kindKey})
+		for name := range names {
+			key := &datastore.Key{Kind: "__property__", Name: name, Parent: kindKey, Namespace: namespace}
+			entities = append(entities, datastore.Entity{Key: key})
+		}
+	}
+	return entities
+}
+
+// kindEntities returns the entities of the kind in the order of keys
+func (s *MemoryStorage) kindEntities(namespace, kind string) ([]*datastore.Key, []datastore.PropertyList) {
+	s.mu.RLock()
+	entities := s.queryEntities(&Query{Kind: kind, Namespace: namespace})
+	s.mu.RUnlock()
+
+	return evaluateQuery(&Query{Kind: kind}, entities)
+}
+
+func memoryKey(k *datastore.Key) string {
+	return k.Namespace + "/" + KeyPathToString(k)
+}
+
+type memoryTransaction struct {
+	storage *MemoryStorage
+	puts    []datastore.Entity
+}
+
+func (tx *memoryTransaction) GetMulti(keys []*datastore.Key, dst interface{}) error {
+	return tx.storage.getMulti(keys, dst)
+}
+
+func (tx *memoryTransaction) PutMulti(keys []*datastore.Key, src interface{}) error {
+	entities, err := saveEntities(keys, src)
+	if err != nil {
+		return err
+	}
+	tx.puts = append(tx.puts, entities...)
+	return nil
+}
+
+type memoryIterator struct {
+	keys       []*datastore.Key
+	properties []datastore.PropertyList
+	index      int
+	end        int
+}
+
+func (it *memoryIterator) Next(dst interface{}) (*datastore.Key, error) {
+	if it.index >= it.end {
+		return nil, iterator.Done
+	}
+
+	key, pl := it.keys[it.index], it.properties[it.index]
+	it.index++
+
+	if dst != nil {
+		if err := loadEntity(reflect.ValueOf(dst), pl); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Cursor returns the position of the next result
+func (it *memoryIterator) Cursor() (string, error) {
+	return base64.RawURLEncoding.EncodeToString([]byte(memoryCursorPrefix + strconv.Itoa(it.index))), nil
+}
+
+// decodeMemoryCursor returns the position of the cursor, or defaultPosition if the cursor is empty
+func decodeMemoryCursor(cursor string, defaultPosition int) (int, error) {
+	if cursor == "" {
+		return defaultPosition, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), memoryCursorPrefix) {
+		return 0, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	position, err := strconv.Atoi(strings.TrimPrefix(string(b), memoryCursorPrefix))
+	if err != nil || position < 0 {
+		return 0, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return position, nil
+}
+
+// saveEntities converts a slice of PropertyList, PropertyLoadSaver or struct into entities
+func saveEntities(keys []*datastore.Key, src interface{}) ([]datastore.Entity, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Slice || v.Len() != len(keys) {
+		return nil, fmt.Errorf("src should be a slice of the same length as keys: %T", src)
+	}
+
+	entities := make([]datastore.Entity, len(keys))
+	for i, k := range keys {
+		if k == nil {
+			return nil, datastore.ErrInvalidKey
+		}
+
+		properties, err := saveEntity(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		entities[i] = datastore.Entity{Key: k, Properties: properties}
+	}
+	return entities, nil
+}
+
+func saveEntity(v reflect.Value) ([]datastore.Property, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+
+	var properties []datastore.Property
+	var err error
+	switch t := v.Interface().(type) {
+	case datastore.PropertyList:
+		properties = t
+	case datastore.PropertyLoadSaver:
+		properties, err = t.Save()
+	default:
+		properties, err = datastore.SaveStruct(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the storage does not share the slice with the caller
+	return append([]datastore.Property(nil), properties...), nil
+}
+
+func loadEntity(v reflect.Value, properties []datastore.Property) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	if v.Kind() != reflect.Ptr {
+		return errors.New("destination of entity should be a pointer")
+	}
+
+	properties = append([]datastore.Property(nil), properties...)
+	switch t := v.Interface().(type) {
+	case datastore.PropertyLoadSaver:
+		return t.Load(properties)
+	default:
+		return datastore.LoadStruct(t, properties)
+	}
+}
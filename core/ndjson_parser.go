@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/datastore"
+)
+
+// NDJSONParser parses newline delimited JSON. Each line is an entity,
+// or a header which has `scheme` and `default` of the following entities.
+type NDJSONParser struct {
+	parsers []*Parser
+}
+
+func NewNDJSONParser() *NDJSONParser {
+	return &NDJSONParser{
+		parsers: []*Parser{
+			{&KindData{}},
+		},
+	}
+}
+
+func (p *NDJSONParser) ReadFile(filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	return p.Read(fp)
+}
+
+// Read reads lines of entities and headers
+func (p *NDJSONParser) Read(r io.Reader) error {
+	var parsers []*Parser
+	var current *KindData
+
+	err := scanNDJSON(r, func(d *KindData) error {
+		current = d
+		parsers = append(parsers, &Parser{current})
+		return nil
+	}, func(e Entity) error {
+		if current == nil {
+			current = &KindData{}
+			parsers = append(parsers, &Parser{current})
+		}
+		current.Entities = append(current.Entities, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(parsers) > 0 {
+		p.parsers = parsers
+	}
+	return nil
+}
+
+// Stream reads lines and calls fn with each entity, without keeping entities in memory.
+// The kind and the namespace in context are applied as Parse does.
+func (p *NDJSONParser) Stream(r io.Reader, kind string, fn func(datastore.Entity) error) error {
+	var parser *Parser
+	setHeader := func(d *KindData) error {
+		parser = &Parser{d}
+		if err := parser.SetKind(kind); err != nil {
+			return err
+		}
+		return parser.SetNameSpace(ctx.Namespace)
+	}
+
+	n := 0
+	return scanNDJSON(r, setHeader, func(e Entity) error {
+		n++
+		if parser == nil {
+			if err := setHeader(&KindData{}); err != nil {
+				return err
+			}
+		}
+		if err := parser.validateEntity(e); err != nil {
+			return fmt.Errorf("entity No.%d: %v", n, err)
+		}
+		dsEntity, err := parser.ParseEntity(e)
+		if err != nil {
+			return fmt.Errorf("entity No.%d: %v", n, err)
+		}
+		return fn(dsEntity)
+	})
+}
+
+// scanNDJSON reads the reader line by line, and calls header with headers and entity with the other lines
+func scanNDJSON(r io.Reader, header func(*KindData) error, entity func(Entity) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var values map[string]interface{}
+		if err := decodeJSONNumber(line, &values); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+
+		if isNDJSONHeader(values) {
+			d := &KindData{}
+			if err := decodeJSONNumber(line, d); err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+			normalizeKindData(d)
+			if err := header(d); err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+			continue
+		}
+
+		e := make(Entity, len(values))
+		for name, v := range values {
+			e[name] = normalizeJSONValue(v)
+		}
+		if err := entity(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// decodeJSONNumber decodes JSON keeping numbers as json.Number
+func decodeJSONNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// isNDJSONHeader reports whether the line has only `scheme` and `default`
+func isNDJSONHeader(values map[string]interface{}) bool {
+	if _, ok := values["scheme"]; !ok {
+		return false
+	}
+	for name := range values {
+		if name != "scheme" && name != "default" {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse entities of all kinds in file order
+func (p *NDJSONParser) Parse(kind string) (*[]datastore.Entity, error) {
+	return parseKinds(p.parsers, kind, ctx.Namespace)
+}
+
+func (p *NDJSONParser) Schemes() []Scheme {
+	return getSchemes(p.parsers)
+}
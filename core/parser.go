@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -15,22 +16,28 @@ import (
 
 type FileParser interface {
 	ReadFile(filename string) error
+	Read(r io.Reader) error
 	Parse(kind string) (*[]datastore.Entity, error)
+	Schemes() []Scheme
 }
 
 type KindData struct {
-	Scheme   Scheme   `yaml:"scheme,omitempty"`
-	Default  Default  `yaml:"default,omitempty"`
-	Entities []Entity `yaml:"entities,omitempty"`
+	Scheme   Scheme   `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+	Default  Default  `yaml:"default,omitempty" json:"default,omitempty"`
+	Entities []Entity `yaml:"entities,omitempty" json:"entities,omitempty"`
 }
 
 type Scheme struct {
-	Namespace  string     `yaml:"namespace,omitempty"`
-	Kind       string     `yaml:"kind,omitempty"`
-	Key        string     `yaml:"key,omitempty"`
-	TimeFormat string     `yaml:"time-format,omitempty"` // used for time.ParseInLocation()
-	TimeLocale string     `yaml:"time-locale,omitempty"` // used for time.ParseInLocation()
-	Properties Properties `yaml:"properties,omitempty"`
+	Namespace  string     `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Kind       string     `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Key        string     `yaml:"key,omitempty" json:"key,omitempty"`
+	TimeFormat string     `yaml:"time-format,omitempty" json:"time-format,omitempty"` // used for time.ParseInLocation()
+	TimeLocale string     `yaml:"time-locale,omitempty" json:"time-locale,omitempty"` // used for time.ParseInLocation()
+	Properties Properties `yaml:"properties,omitempty" json:"properties,omitempty"`
+}
+
+func (d KindData) isEmpty() bool {
+	return d.Scheme.Kind == "" && len(d.Scheme.Properties) == 0 && len(d.Default) == 0 && len(d.Entities) == 0
 }
 
 type Properties map[string]interface{}
@@ -41,6 +48,42 @@ type Parser struct {
 	kindData *KindData
 }
 
+// parseKinds parses entities of all kinds in order. Kinds without namespace in their scheme are in the namespace.
+func parseKinds(parsers []*Parser, kind, namespace string) (*[]datastore.Entity, error) {
+
+	var res []datastore.Entity
+	for _, parser := range parsers {
+		if err := parser.SetKind(kind); err != nil {
+			return nil, err
+		}
+		if err := parser.SetNameSpace(namespace); err != nil {
+			return nil, err
+		}
+		if err := parser.Validate(ctx); err != nil {
+			return nil, err
+		}
+
+		d := *parser.kindData
+
+		for _, e := range d.Entities {
+			if entry, err := parser.ParseEntity(e); err != nil {
+				return nil, err
+			} else {
+				res = append(res, entry)
+			}
+		}
+	}
+	return &res, nil
+}
+
+func getSchemes(parsers []*Parser) []Scheme {
+	schemes := make([]Scheme, 0, len(parsers))
+	for _, parser := range parsers {
+		schemes = append(schemes, parser.kindData.Scheme)
+	}
+	return schemes
+}
+
 func (p *Parser) SetKind(optionKind string) error {
 	if optionKind == "" {
 		return nil
@@ -78,8 +121,20 @@ func (p *Parser) SetNameSpace(namespace string) error {
 }
 
 func (p *Parser) Validate(ctx Context) error {
+	for _, e := range p.kindData.Entities {
+		if err := p.validateEntity(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Parser) validateEntity(e Entity) error {
 	if p.kindData.Scheme.Kind == "" {
-		return errors.New("kind should be specified")
+		// entities of various kinds (e.g. output of kindless query) have kinds in their keys
+		if _, ok := e[KeywordKey]; !ok {
+			return errors.New("kind should be specified")
+		}
 	}
 	return nil
 }
@@ -131,6 +186,10 @@ func (p *Parser) ParseEntity(entity Entity) (dsEntity datastore.Entity, err erro
 	if key == nil {
 		key = p.getDSIncompleteKey(d.Scheme.Kind, nil)
 	}
+	if key.Kind == "" {
+		err = fmt.Errorf("kind of key %v should be specified", KeyToString(key))
+		return
+	}
 
 	return datastore.Entity{
 		Key:        key,
@@ -181,8 +240,11 @@ func (p *Parser) parseKey(kind string, val interface{}, parent *datastore.Key) (
 	case int64:
 		key = p.getDSIDKey(kind, v, parent)
 	case int:
+		key = p.getDSIDKey(kind, int64(v), parent)
 	case int32:
+		key = p.getDSIDKey(kind, int64(v), parent)
 	case float32:
+		key = p.getDSIDKey(kind, int64(v), parent)
 	case float64:
 		key = p.getDSIDKey(kind, int64(v), parent)
 	default:
@@ -362,7 +424,7 @@ func (p *Parser) parseValueWithType(spType DatastoreType, val interface{}) (valu
 	case TypeInteger, TypeInt:
 		var str = ToString(val)
 		if str == "" {
-			value = 0
+			value = int64(0)
 		} else if num, e := strconv.ParseInt(str, 10, 64); e != nil {
 			err = fmt.Errorf("can not parse '%v' as int. err:%v", str, e)
 		} else {
@@ -506,7 +568,8 @@ func (p *Parser) parseTimestamp(v interface{}, loc *time.Location) (time.Time, b
 			`T[0-9][0-9]` + // (hour)
 			`:[0-9][0-9]` + // (minute)
 			`:[0-9][0-9]` + // (second)
-			`Z|[-+][0-9][0-9]:[0-9][0-9]$`: time.RFC3339, // (time zone)
+			`(\.[0-9]+)?` + // (fraction of second)
+			`(Z|[-+][0-9][0-9]:[0-9][0-9])$`: time.RFC3339, // (time zone)
 	}
 
 	for regx, format := range regxs {
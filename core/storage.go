@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// BackendDatastore is Google Cloud Datastore (or the emulator)
+	BackendDatastore = "datastore"
+	// BackendMemory keeps entities in memory while the command runs
+	BackendMemory = "memory"
+)
+
+// Storage is the operations of Datastore which dsio uses
+type Storage interface {
+	PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error)
+	GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error
+	DeleteMulti(ctx context.Context, keys []*datastore.Key) error
+	AllocateIDs(ctx context.Context, keys []*datastore.Key) ([]*datastore.Key, error)
+	Run(ctx context.Context, q *Query) Iterator
+	RunAggregationQuery(ctx context.Context, q *Query, aggregations []Aggregation) (map[string]interface{}, error)
+	RunInTransaction(ctx context.Context, f func(tx Transaction) error) error
+	Close() error
+}
+
+// Transaction is the operations in a transaction. Puts are applied when the transaction is committed.
+type Transaction interface {
+	GetMulti(keys []*datastore.Key, dst interface{}) error
+	PutMulti(keys []*datastore.Key, src interface{}) error
+}
+
+// Iterator is the result of a query. Next returns iterator.Done at the end.
+type Iterator interface {
+	Next(dst interface{}) (*datastore.Key, error)
+	Cursor() (string, error)
+}
+
+// Query is a query which every storage can run.
+// Limit and Offset are ignored if they are 0, and Start and End are cursor strings returned by Iterator.Cursor.
+type Query struct {
+	Kind       string
+	Namespace  string
+	Ancestor   *datastore.Key
+	Filters    []datastore.EntityFilter
+	Orders     []Order
+	Projection []string
+	Distinct   bool
+	DistinctOn []string
+	KeysOnly   bool
+	Offset     int
+	Limit      int
+	Start      string
+	End        string
+}
+
+type Order struct {
+	Property   string
+	Descending bool
+}
+
+type AggregationFunction string
+
+const (
+	AggregationCount = AggregationFunction("count")
+	AggregationSum   = AggregationFunction("sum")
+	AggregationAvg   = AggregationFunction("avg")
+)
+
+// Aggregation is an aggregation of query result. The result is returned with the alias.
+type Aggregation struct {
+	Function AggregationFunction
+	Property string
+	Alias    string
+}
+
+var (
+	memoryStorage     *MemoryStorage
+	memoryStorageOnce sync.Once
+)
+
+// CreateStorage returns the storage of the backend in context
+func CreateStorage(ctx Context) (Storage, error) {
+	switch ctx.Backend {
+	case "", BackendDatastore:
+		return NewDatastoreStorage(ctx)
+
+	case BackendMemory:
+		// commands in the same process share the entities
+		memoryStorageOnce.Do(func() {
+			memoryStorage = NewMemoryStorage()
+		})
+		return memoryStorage, nil
+
+	default:
+		if dir, ok := fileStorageDir(ctx.Backend); ok {
+			return OpenFileStorage(dir)
+		}
+		return nil, fmt.Errorf("unknown backend: %s", ctx.Backend)
+	}
+}
+
+// GetAll returns keys and entities of all results of the query
+func GetAll(ctx context.Context, s Storage, q *Query) ([]*datastore.Key, []datastore.PropertyList, error) {
+	keys := make([]*datastore.Key, 0)
+	entities := make([]datastore.PropertyList, 0)
+
+	iter := s.Run(ctx, q)
+	for {
+		var entity datastore.PropertyList
+		key, err := iter.Next(&entity)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		entities = append(entities, entity)
+	}
+	return keys, entities, nil
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"cloud.google.com/go/datastore"
+	"golang.org/x/term"
 )
 
 func ToString(value interface{}) string {
@@ -24,12 +25,14 @@ func ToFloat64(val interface{}) (float64, error) {
 	switch v := val.(type) {
 	case float64:
 		return v, nil
-	case float32, int, int32, int64:
-		if v, ok := v.(float64); ok {
-			return v, nil
-		} else {
-			return 0, fmt.Errorf("can not convert %v to float64", val)
-		}
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
 	case string:
 		return strconv.ParseFloat(v, 64)
 	}
@@ -58,6 +61,11 @@ func KeyToString(k *datastore.Key) string {
 			return strconv.Quote(k.Name)
 		}
 	}
+	return KeyPathToString(k)
+}
+
+// KeyPathToString returns kinds and ids (or names) of the key and its ancestors like `["Parent",1,"Child","name"]`
+func KeyPathToString(k *datastore.Key) string {
 
 	keys := make([]string, 0)
 
@@ -78,8 +86,21 @@ func KeyToString(k *datastore.Key) string {
 	}
 }
 
+// IsTerminal reports whether the file is a terminal.
+// Character devices which are not terminals like /dev/null are not.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
 func ConfirmYesNo(msg string) (bool, error) {
 
+	if ctx.Yes {
+		Debugf("%s -> yes (--yes)\n", msg)
+		return true, nil
+	} else if ctx.NonInteractive {
+		return false, fmt.Errorf("can not confirm '%s' in non-interactive mode. use --yes option", msg)
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
@@ -92,10 +113,10 @@ func ConfirmYesNo(msg string) (bool, error) {
 
 		switch strings.ToUpper(strings.Trim(answer, "\n")) {
 		case "Y":
-			fmt.Println("")
+			fmt.Fprintln(os.Stderr, "")
 			return true, nil
 		case "N":
-			fmt.Println("")
+			fmt.Fprintln(os.Stderr, "")
 			return false, nil
 		default:
 			// confirm once more
@@ -105,6 +126,14 @@ func ConfirmYesNo(msg string) (bool, error) {
 
 func ConfirmYesNoWithDefault(msg string, defaultValue bool) (bool, error) {
 
+	if ctx.Yes {
+		Debugf("%s -> yes (--yes)\n", msg)
+		return true, nil
+	} else if ctx.NonInteractive {
+		Debugf("%s -> %v (non-interactive)\n", msg, defaultValue)
+		return defaultValue, nil
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		var confirmStr string
@@ -123,13 +152,13 @@ func ConfirmYesNoWithDefault(msg string, defaultValue bool) (bool, error) {
 
 		switch strings.ToUpper(strings.Trim(answer, "\n")) {
 		case "Y":
-			fmt.Println("")
+			fmt.Fprintln(os.Stderr, "")
 			return true, nil
 		case "N":
-			fmt.Println("")
+			fmt.Fprintln(os.Stderr, "")
 			return false, nil
 		case "":
-			fmt.Println("")
+			fmt.Fprintln(os.Stderr, "")
 			return defaultValue, nil
 		default:
 			// confirm once more
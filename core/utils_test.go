@@ -0,0 +1,27 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTerminal(t *testing.T) {
+	// /dev/null is a character device, but not a terminal
+	f, err := os.Open(os.DevNull)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+	assert.False(t, IsTerminal(f))
+
+	// regular files are not terminals
+	tmp, err := os.CreateTemp("", "dsio")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	assert.False(t, IsTerminal(tmp))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 	"time"
 
 	"cloud.google.com/go/datastore"
@@ -75,7 +76,11 @@ func (exp *YAMLExport) getScheme(propInfos []PropertyInfo) (Scheme, error) {
 			if err != nil {
 				return Scheme{}, err
 			}
-			properties[info.Name] = t
+			if info.Property.NoIndex {
+				properties[info.Name] = []string{string(t), KeywordNoIndexValue}
+			} else {
+				properties[info.Name] = t
+			}
 		}
 		scheme.Properties = properties
 	}
@@ -164,8 +169,19 @@ func (exp *YAMLExport) getValueByStyle(val interface{}, noIndex bool) (value int
 
 func (exp *YAMLExport) getAutoTypedValue(val interface{}, noIndex bool) (value interface{}, err error) {
 
-	switch val.(type) {
-	case string, time.Time, int64, float64, bool, []interface{}, *datastore.Entity, nil:
+	if noIndex {
+		return exp.getDirectTypedValue(val, noIndex)
+	}
+
+	switch v := val.(type) {
+	case float64:
+		// floats like 1.0 are written as 1 in YAML. Without scheme, the type is kept by the keyword.
+		if exp.style == StyleAuto && v == math.Trunc(v) {
+			value, err = exp.getDirectTypedValue(val, noIndex)
+		} else {
+			value, err = exp.getValue(val)
+		}
+	case string, time.Time, int64, bool, []interface{}, *datastore.Entity, nil:
 		value, err = exp.getValue(val)
 	default:
 		value, err = exp.getDirectTypedValue(val, noIndex)
@@ -210,7 +226,7 @@ func (exp *YAMLExport) getValue(v interface{}) (value interface{}, err error) {
 		value = v
 
 	case *datastore.Key:
-		value = exp.keyValue(v)
+		value = exp.keyPathValue(v)
 
 	case time.Time:
 		value = v
@@ -235,6 +251,11 @@ func (exp *YAMLExport) getValue(v interface{}) (value interface{}, err error) {
 
 func (exp *YAMLExport) keyValue(k *datastore.Key) interface{} {
 
+	// entities of kindless query have various kinds
+	if exp.kind == "" {
+		return exp.keyPathValue(k)
+	}
+
 	if k.Parent == nil {
 		if k.ID != 0 {
 			return k.ID
@@ -242,6 +263,11 @@ func (exp *YAMLExport) keyValue(k *datastore.Key) interface{} {
 			return k.Name
 		}
 	}
+	return exp.keyPathValue(k)
+}
+
+// keyPathValue returns kinds and ids (or names) of the key and its ancestors. Used for key properties, whose kind is not the kind of the scheme.
+func (exp *YAMLExport) keyPathValue(k *datastore.Key) []interface{} {
 
 	keys := make([]interface{}, 0)
 
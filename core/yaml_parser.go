@@ -2,7 +2,8 @@ package core
 
 import (
 	"errors"
-	"io/ioutil"
+	"io"
+	"os"
 
 	"cloud.google.com/go/datastore"
 	"gopkg.in/yaml.v2"
@@ -13,51 +14,71 @@ var (
 )
 
 type YAMLParser struct {
-	parser *Parser
+	parsers []*Parser
+}
+
+// yamlDocument is a document in YAML file. A document has one kind, or multiple kinds in `kinds`.
+type yamlDocument struct {
+	KindData `yaml:",inline"`
+	Kinds    []KindData `yaml:"kinds,omitempty"`
 }
 
 func NewYAMLParser() *YAMLParser {
 	return &YAMLParser{
-		parser: &Parser{
-			&KindData{},
+		parsers: []*Parser{
+			{&KindData{}},
 		},
 	}
 }
 
 func (p *YAMLParser) ReadFile(filename string) error {
-	source, err := ioutil.ReadFile(filename)
+	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	d := &KindData{}
-	if err = yaml.Unmarshal([]byte(source), d); err != nil {
-		return err
+	return p.Read(f)
+}
+
+// Read reads YAML documents separated by `---`
+func (p *YAMLParser) Read(r io.Reader) error {
+	decoder := yaml.NewDecoder(r)
+
+	var parsers []*Parser
+	for {
+		d := &yamlDocument{}
+		if err := decoder.Decode(d); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if !d.KindData.isEmpty() {
+			kindData := d.KindData
+			parsers = append(parsers, &Parser{&kindData})
+		}
+		for i := range d.Kinds {
+			parsers = append(parsers, &Parser{&d.Kinds[i]})
+		}
+	}
+
+	if len(parsers) > 0 {
+		p.parsers = parsers
 	}
-	p.parser.kindData = d
 	return nil
 }
 
+// Parse entities of all kinds in file order
 func (p *YAMLParser) Parse(kind string) (*[]datastore.Entity, error) {
-	if err := p.parser.SetKind(kind); err != nil {
-		return nil, err
-	}
-	if err := p.parser.SetNameSpace(ctx.Namespace); err != nil {
-		return nil, err
-	}
-	if err := p.parser.Validate(ctx); err != nil {
-		return nil, err
-	}
+	return parseKinds(p.parsers, kind, ctx.Namespace)
+}
 
-	d := *p.parser.kindData
+// ParseNamespace parses entities of all kinds in the namespace, instead of the namespace in context
+func (p *YAMLParser) ParseNamespace(namespace string) (*[]datastore.Entity, error) {
+	return parseKinds(p.parsers, "", namespace)
+}
 
-	var res []datastore.Entity
-	for _, e := range d.Entities {
-		if entry, err := p.parser.ParseEntity(e); err != nil {
-			return nil, err
-		} else {
-			res = append(res, entry)
-		}
-	}
-	return &res, nil
+func (p *YAMLParser) Schemes() []Scheme {
+	return getSchemes(p.parsers)
 }
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAMLParserMultipleDocuments(t *testing.T) {
+	parser := NewYAMLParser()
+	err := parser.Read(strings.NewReader(`
+scheme:
+  kind: Author
+  properties:
+    Code: string
+default:
+  Active: true
+entities:
+  - __key__: huxley
+    Code: 100
+---
+scheme:
+  kind: Book
+entities:
+  - __key__: 1
+    Code: 200
+  - __key__: 2
+`))
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(*entities))
+
+	// entities are in file order
+	author, book1, book2 := (*entities)[0], (*entities)[1], (*entities)[2]
+	assert.Equal(t, datastore.NameKey("Author", "huxley", nil), author.Key)
+	assert.Equal(t, datastore.IDKey("Book", 1, nil), book1.Key)
+	assert.Equal(t, datastore.IDKey("Book", 2, nil), book2.Key)
+
+	// scheme and default of Author are not applied to Book
+	assert.Equal(t, "100", findProperty(author, "Code"))
+	assert.Equal(t, true, findProperty(author, "Active"))
+	assert.Equal(t, int64(200), findProperty(book1, "Code"))
+	assert.Nil(t, findProperty(book1, "Active"))
+	assert.Nil(t, findProperty(book2, "Active"))
+
+	schemes := parser.Schemes()
+	assert.Equal(t, 2, len(schemes))
+	assert.Equal(t, "Author", schemes[0].Kind)
+	assert.Equal(t, "Book", schemes[1].Kind)
+
+	// the kind option can not be applied to multiple kinds
+	_, err = parser.Parse("Author")
+	assert.Error(t, err)
+}
+
+func TestYAMLParserDocumentSeparators(t *testing.T) {
+	parser := NewYAMLParser()
+	err := parser.Read(strings.NewReader(`--- # authors
+scheme:
+  kind: Author
+entities:
+  - __key__: huxley
+    Bio: |
+      first part
+      ---
+      second part
+...
+%YAML 1.1
+---
+scheme:
+  kind: Book
+entities:
+  - __key__: 1
+--- {scheme: {kind: Publisher}, entities: [{__key__: chatto}]}
+...
+`))
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(*entities)) {
+		return
+	}
+
+	// "---" in a block scalar does not separate documents
+	author := (*entities)[0]
+	assert.Equal(t, datastore.NameKey("Author", "huxley", nil), author.Key)
+	assert.Equal(t, "first part\n---\nsecond part\n", findProperty(author, "Bio"))
+	assert.Equal(t, datastore.IDKey("Book", 1, nil), (*entities)[1].Key)
+	assert.Equal(t, datastore.NameKey("Publisher", "chatto", nil), (*entities)[2].Key)
+}
+
+func TestYAMLParserKinds(t *testing.T) {
+	parser := NewYAMLParser()
+	err := parser.ReadFile("../samples/yaml/kinds.yaml")
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(*entities))
+
+	// parents are written before children
+	author, book := (*entities)[0], (*entities)[1]
+	assert.Equal(t, datastore.NameKey("Author", "Huxley", nil), author.Key)
+	assert.Equal(t, datastore.IDKey("Book", 1, nil), book.Key)
+
+	// default of Book is not applied to Author
+	assert.Nil(t, findProperty(author, "Public"))
+	assert.Equal(t, false, findProperty(book, "Public"))
+	assert.Equal(t, datastore.NameKey("Author", "Huxley", nil), findProperty(book, "Author"))
+}
+
+func TestYAMLParserNamespaceOfKinds(t *testing.T) {
+	parser := NewYAMLParser()
+	err := parser.ReadFile("../samples/yaml/multi.yaml")
+	assert.Nil(t, err)
+
+	entities, err := parser.Parse("")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(*entities))
+
+	kinds := make([]string, 0, len(*entities))
+	for _, e := range *entities {
+		assert.Equal(t, "development", e.Key.Namespace)
+		kinds = append(kinds, e.Key.Kind)
+	}
+	assert.Equal(t, []string{"Category", "Category", "Book", "Book"}, kinds)
+
+	// Price is float by the scheme of Book
+	assert.Equal(t, 18.38, findProperty((*entities)[2], "Price"))
+}
+
+// findProperty returns the value of the property, or nil if the entity does not have it
+func findProperty(e datastore.Entity, name string) interface{} {
+	for _, p := range e.Properties {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return nil
+}
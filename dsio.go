@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/nshmura/dsio/action"
 	"github.com/nshmura/dsio/core"
@@ -50,6 +51,18 @@ var (
 		Name:  "namespace, n",
 		Usage: "namespace of entities.",
 	}
+
+	FlagBackend = cli.StringFlag{
+		Name:   "backend",
+		Value:  core.BackendDatastore,
+		Usage:  "storage of entities. <datastore|memory|file:DIR>. memory keeps entities only while the command runs, and file:DIR keeps them in the directory.",
+		EnvVar: "DSIO_BACKEND",
+	}
+
+	FlagYes = cli.BoolFlag{
+		Name:  "yes, y, non-interactive",
+		Usage: "Answer yes to all confirmations. Confirmations are also skipped when stdin is not a terminal.",
+	}
 )
 
 func main() {
@@ -64,11 +77,15 @@ func main() {
 	app.Usage = "A command line tool for Google Cloud Datastore."
 	app.Version = Version
 
+	app.Flags = []cli.Flag{
+		FlagYes,
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:      "upsert",
 			Usage:     "Bulk-upsert entities into Datastore.",
-			ArgsUsage: "filename",
+			ArgsUsage: "filename|directory|glob|- [...]",
 			Flags: []cli.Flag{
 				FlagNamespace,
 				cli.StringFlag{
@@ -77,7 +94,7 @@ func main() {
 				},
 				cli.StringFlag{
 					Name:  "format, f",
-					Usage: "format of input file. <yaml|csv|tcv>.",
+					Usage: "format of input file. <yaml|json|ndjson|csv|tcv>. required to read from stdin (-).",
 				},
 				cli.BoolFlag{
 					Name:  "dry-run",
@@ -86,10 +103,101 @@ func main() {
 				cli.IntFlag{
 					Name:  "batch-size",
 					Value: action.MaxBatchSize,
-					Usage: fmt.Sprintf("number of entities per one multi upsert operation. batch-size should be smaller than %s.", action.MaxBatchSize),
+					Usage: fmt.Sprintf("number of entities per one multi upsert operation. batch-size should be smaller than %d.", action.MaxBatchSize),
+				},
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: action.ModeUpsert,
+					Usage: "write mode. <upsert|insert|update>. insert writes only new entities, update writes only existing entities.",
+				},
+				cli.BoolFlag{
+					Name:  "merge",
+					Usage: "overlay properties in the file (including default values) on existing entities, and preserve other properties.",
+				},
+				cli.StringFlag{
+					Name:  "on-conflict",
+					Value: action.ConflictSkip,
+					Usage: "how to handle existing entities in insert mode and missing entities in update mode. <skip|fail>.",
+				},
+				cli.IntFlag{
+					Name:  "concurrency",
+					Value: 1,
+					Usage: "number of batches upserted in parallel. 0 and 1 upsert batches one by one. batches are confirmed only once if it is more than 1.",
+				},
+				cli.IntFlag{
+					Name:  "max-retries",
+					Value: 5,
+					Usage: "max number of retries for transient errors like contention or unavailability. 0 disables retries.",
+				},
+				cli.DurationFlag{
+					Name:  "retry-timeout",
+					Value: time.Minute,
+					Usage: "max duration of retrying a batch. 0 means no timeout.",
+				},
+				cli.BoolFlag{
+					Name:  "resume",
+					Usage: "resume upserting from the checkpoint file written by the previous run.",
+				},
+				cli.StringFlag{
+					Name:  "checkpoint-dir",
+					Usage: "directory of checkpoint files. default is dsio directory in the temporary directory.",
+				},
+				FlagServiceAccoutFile,
+				FlagProjectID,
+				FlagBackend,
+				FlagVerbose,
+				FlagNoColor,
+				FlagYes,
+			},
+			Action: func(c *cli.Context) error {
+				args := c.Args()
+				if len(args) == 0 {
+					return core.NewExitError("Filename is not specified")
+				}
+
+				ctx := core.SetContext(c)
+				ctx.PrintContext()
+
+				err := action.Upsert(ctx, args, action.UpsertOption{
+					Kind:          c.String("kind"),
+					Format:        c.String("format"),
+					BatchSize:     c.Int("batch-size"),
+					Mode:          c.String("mode"),
+					OnConflict:    c.String("on-conflict"),
+					Merge:         c.Bool("merge"),
+					Concurrency:   c.Int("concurrency"),
+					MaxRetries:    c.Int("max-retries"),
+					RetryTimeout:  c.Duration("retry-timeout"),
+					Resume:        c.Bool("resume"),
+					CheckpointDir: c.String("checkpoint-dir"),
+				})
+				if err != nil {
+					return core.NewExitError(err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "Show differences between entities in the file and Datastore.",
+			ArgsUsage: "filename",
+			Flags: []cli.Flag{
+				FlagNamespace,
+				cli.StringFlag{
+					Name:  "kind, k",
+					Usage: "name of destination kind.",
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "format of input file. <yaml|json|ndjson|csv|tcv>.",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "output differences in JSON.",
 				},
 				FlagServiceAccoutFile,
 				FlagProjectID,
+				FlagBackend,
 				FlagVerbose,
 				FlagNoColor,
 			},
@@ -106,7 +214,108 @@ func main() {
 				ctx := core.SetContext(c)
 				ctx.PrintContext()
 
-				err := action.Upsert(ctx, filename, c.String("kind"), c.String("format"), c.Int("batch-size"))
+				err := action.Diff(ctx, filename, c.String("kind"), c.String("format"), c.Bool("json"))
+				if err != nil {
+					return core.NewExitError(err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "sync",
+			Usage:     "Make entities of the kind exactly match the file. Entities not in the file are deleted.",
+			ArgsUsage: "filename",
+			Flags: []cli.Flag{
+				FlagNamespace,
+				cli.StringFlag{
+					Name:  "kind, k",
+					Usage: "name of destination kind.",
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "format of input file. <yaml|json|ndjson|csv|tcv>.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the plan and skip Datastore write operations.",
+				},
+				cli.IntFlag{
+					Name:  "batch-size",
+					Value: action.MaxBatchSize,
+					Usage: fmt.Sprintf("number of entities per one multi operation. batch-size should be smaller than %d.", action.MaxBatchSize),
+				},
+				FlagServiceAccoutFile,
+				FlagProjectID,
+				FlagBackend,
+				FlagVerbose,
+				FlagNoColor,
+				FlagYes,
+			},
+			Action: func(c *cli.Context) error {
+				args := c.Args()
+				if l := len(args); l == 0 {
+					return core.NewExitError("Filename is not specified")
+
+				} else if l > 1 {
+					return core.NewExitError("Too many args")
+				}
+				filename := args[0]
+
+				ctx := core.SetContext(c)
+				ctx.PrintContext()
+
+				err := action.Sync(ctx, filename, c.String("kind"), c.String("format"), c.Int("batch-size"))
+				if err != nil {
+					return core.NewExitError(err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "Bulk-delete entities from Datastore.",
+			ArgsUsage: "[filename]",
+			Flags: []cli.Flag{
+				FlagNamespace,
+				cli.StringFlag{
+					Name:  "kind, k",
+					Usage: "name of target kind. used only with filename.",
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "format of input file. <yaml|json|ndjson|csv|tcv>.",
+				},
+				cli.StringFlag{
+					Name:  "query, q",
+					Usage: "GQL query to select entities to delete.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "skip Datastore operations.",
+				},
+				cli.IntFlag{
+					Name:  "batch-size",
+					Value: action.MaxBatchSize,
+					Usage: fmt.Sprintf("number of entities per one multi delete operation. batch-size should be smaller than %d.", action.MaxBatchSize),
+				},
+				FlagServiceAccoutFile,
+				FlagProjectID,
+				FlagBackend,
+				FlagVerbose,
+				FlagNoColor,
+				FlagYes,
+			},
+			Action: func(c *cli.Context) error {
+				args := c.Args()
+				if len(args) > 1 {
+					return core.NewExitError("Too many args")
+				}
+				filename := args.First()
+
+				ctx := core.SetContext(c)
+				ctx.PrintContext()
+
+				err := action.Delete(ctx, filename, c.String("kind"), c.String("format"), c.String("query"), c.Int("batch-size"))
 				if err != nil {
 					return core.NewExitError(err)
 				}
@@ -115,7 +324,7 @@ func main() {
 		},
 		{
 			Name:      "query",
-			Usage:     "Execute a query.",
+			Usage:     "Execute a query. Without a query, an interactive shell is started, or queries separated by ';' are read from stdin pipe.",
 			ArgsUsage: `"[<gql_query>]"`,
 			Flags: []cli.Flag{
 				FlagNamespace,
@@ -126,34 +335,53 @@ func main() {
 				cli.StringFlag{
 					Name:  "format, f",
 					Value: "yaml",
-					Usage: "format of output. <yaml|csv|tcv>.",
+					Usage: "format of output. <yaml|json|ndjson>.",
 				},
 				cli.StringFlag{
 					Name:  "style, s",
 					Value: "scheme",
-					Usage: "style of output. <scheme|direct|auto>. used only in yaml format.",
+					Usage: "style of output. <scheme|direct|auto>.",
 				},
 				cli.IntFlag{
 					Name:  "page-size",
 					Value: defaultPageSize,
 					Usage: "number of entities to output at once.",
 				},
+				cli.IntFlag{
+					Name:  "max-entities",
+					Usage: "max number of entities to output. 0 means unlimited.",
+				},
+				cli.StringFlag{
+					Name:  "start-cursor",
+					Usage: "cursor to start the query from. used to resume output by the end cursor which was printed.",
+				},
+				cli.StringSliceFlag{
+					Name:  "param",
+					Usage: "parameter of binding site. <name=value|1=value>. value can have type prefix <int:|float:|bool:|string:|datetime:|key:|blob:|null:>.",
+				},
+				cli.StringFlag{
+					Name:  "from-file",
+					Usage: "evaluate the query against entities in the file instead of Datastore. format is detected by extension.",
+				},
 				FlagServiceAccoutFile,
 				FlagProjectID,
+				FlagBackend,
 				FlagVerbose,
 				FlagNoColor,
+				FlagYes,
 			},
 			Action: func(c *cli.Context) error {
 				query := strings.Join(c.Args(), " ")
 
 				var format = c.String("format")
+				// CSV and TSV are not supported, because they drop kinds and types which upsert needs
 				switch format {
-				case core.FormatCSV, core.FormatTSV, core.FormatYAML:
+				case core.FormatYAML, core.FormatJSON, core.FormatNDJSON:
 				// ok
 				case "":
 					format = core.FormatYAML
 				default:
-					return core.NewExitError("Format should be yaml, csv or tsv")
+					return core.NewExitError("Format should be yaml, json or ndjson")
 				}
 
 				style, err := getTypeStyle(c.String("style"))
@@ -172,7 +400,78 @@ func main() {
 				ctx := core.SetContext(c)
 				ctx.PrintContext()
 
-				err = action.Query(ctx, query, format, style, c.String("output"), pageSize)
+				err = action.Query(ctx, query, action.QueryOption{
+					Format:      format,
+					Style:       style,
+					Output:      c.String("output"),
+					PageSize:    pageSize,
+					MaxEntities: c.Int("max-entities"),
+					Params:      c.StringSlice("param"),
+					StartCursor: c.String("start-cursor"),
+					FromFile:    c.String("from-file"),
+				})
+				if err != nil {
+					return core.NewExitError(err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "export",
+			Usage: "Export all kinds in the namespace into a directory. One file is created per kind.",
+			Flags: []cli.Flag{
+				FlagNamespace,
+				cli.StringFlag{
+					Name:  "dir, d",
+					Usage: "output directory.",
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: "yaml",
+					Usage: "format of output. <yaml|json|ndjson>.",
+				},
+				cli.StringFlag{
+					Name:  "style, s",
+					Value: "scheme",
+					Usage: "style of output. <scheme|direct|auto>.",
+				},
+				FlagServiceAccoutFile,
+				FlagProjectID,
+				FlagBackend,
+				FlagVerbose,
+				FlagNoColor,
+				FlagYes,
+			},
+			Action: func(c *cli.Context) error {
+				if len(c.Args()) > 0 {
+					return core.NewExitError("Too many args")
+				}
+
+				dir := c.String("dir")
+				if dir == "" {
+					return core.NewExitError("Directory is not specified")
+				}
+
+				var format = c.String("format")
+				// CSV and TSV are not supported, because they drop kinds and types which upsert needs
+				switch format {
+				case core.FormatYAML, core.FormatJSON, core.FormatNDJSON:
+				// ok
+				case "":
+					format = core.FormatYAML
+				default:
+					return core.NewExitError("Format should be yaml, json or ndjson")
+				}
+
+				style, err := getTypeStyle(c.String("style"))
+				if err != nil {
+					return core.NewExitError(err)
+				}
+
+				ctx := core.SetContext(c)
+				ctx.PrintContext()
+
+				err = action.Export(ctx, dir, format, style)
 				if err != nil {
 					return core.NewExitError(err)
 				}
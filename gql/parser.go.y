@@ -16,6 +16,7 @@ type Expression interface{}
 
 type SelectExpr struct {
     Field FieldExpr
+    Aggregations []AggregationExpr
     From *FromExpr
     Where []ConditionExpr
     Order []OrderExpr
@@ -30,6 +31,13 @@ type FieldExpr struct {
     Asterisk         bool
 }
 
+type AggregationExpr struct {
+    Function AggregationType
+    PropertyName string
+    UpTo int
+    Alias string
+}
+
 type FromExpr struct {
     Kind *KindExpr
 }
@@ -92,6 +100,55 @@ func (c BackwardConditionExpr) GetComparator() ComparatorExpr {
     return c.Comparator
 }
 
+// CompositeConditionExpr is conditions joined by AND or OR.
+// Top level conditions of WHERE are joined by AND, so that AND appears only inside OR.
+type CompositeConditionExpr struct {
+    Operator LogicalOperator
+    Conditions []ConditionExpr
+}
+
+func (c CompositeConditionExpr) GetPropertyName() string {
+    return ""
+}
+
+func (c CompositeConditionExpr) GetValue() ValueExpr {
+    return ValueExpr{}
+}
+
+func (c CompositeConditionExpr) GetComparator() ComparatorExpr {
+    return 0
+}
+
+// newCompositeCondition joins two conditions. Nested conditions of the same operator are flattened.
+func newCompositeCondition(op LogicalOperator, left, right ConditionExpr) CompositeConditionExpr {
+    c := CompositeConditionExpr{Operator: op}
+    for _, e := range []ConditionExpr{left, right} {
+        if composite, ok := e.(CompositeConditionExpr); ok && composite.Operator == op {
+            c.Conditions = append(c.Conditions, composite.Conditions...)
+        } else {
+            c.Conditions = append(c.Conditions, e)
+        }
+    }
+    return c
+}
+
+type LogicalOperator int
+
+const (
+    LOGICAL_AND LogicalOperator = iota + 1
+    LOGICAL_OR
+)
+
+func (o LogicalOperator) String() string {
+    switch o {
+    case LOGICAL_AND:
+        return "AND"
+    case LOGICAL_OR:
+        return "OR"
+    }
+    return ""
+}
+
 type OrderExpr struct {
     PropertyName string
     Sort SortType
@@ -169,6 +226,10 @@ func (c ComparatorExpr) String() string {
         return ">"
     case OP_GREATER_EQUALS:
         return ">="
+    case OP_NOT_EQUALS:
+        return "!="
+    case OP_NOT_IN:
+        return "NOT IN"
     }
     return ""
 }
@@ -184,6 +245,8 @@ const (
     OP_LESS_EQUALS      // <=
     OP_GREATER          // >
     OP_GREATER_EQUALS   // >=
+    OP_NOT_EQUALS       // !=
+    OP_NOT_IN
 )
 
 type ValueType int
@@ -198,8 +261,32 @@ const (
     TYPE_DOUBLE
     TYPE_BOOL
     TYPE_NULL
+    TYPE_ARRAY
+)
+
+type AggregationType int
+
+const (
+    AGG_COUNT AggregationType = iota + 1
+    AGG_COUNT_UP_TO
+    AGG_SUM
+    AGG_AVG
 )
 
+func (a AggregationType) String() string {
+    switch a {
+    case AGG_COUNT:
+        return "COUNT"
+    case AGG_COUNT_UP_TO:
+        return "COUNT_UP_TO"
+    case AGG_SUM:
+        return "SUM"
+    case AGG_AVG:
+        return "AVG"
+    }
+    return ""
+}
+
 type SortType int
 
 const (
@@ -217,6 +304,10 @@ const (
 
 %type<expr> query
 %type<expr> select
+%type<expr> aggregations
+%type<expr> aggregation
+%type<expr> aggregate_function
+%type<expr> opt_alias
 %type<expr> Field
 %type<expr> property_names
 %type<expr> opt_from
@@ -227,6 +318,9 @@ const (
 %type<expr> opt_asc_desc
 %type<expr> opt_offset
 %type<expr> compound_condition
+%type<expr> or_condition
+%type<expr> and_condition
+%type<expr> primary_condition
 %type<expr> condition
 %type<expr> forward_comparator
 %type<expr> backward_comparator
@@ -240,6 +334,7 @@ const (
 %type<expr> kind
 %type<expr> property_name
 %type<expr> value
+%type<expr> values
 
 /* Special tokens */
 %token<token> ILLEGAL
@@ -262,6 +357,7 @@ const (
 %token<token> RIGHT_BRACKETS // >
 %token<token> LEFT_ROUND     // (
 %token<token> RIGHT_ROUND    // )
+%token<token> EXCLAMATION    // !
 
 /* Keywords */
 %token<token> SELECT
@@ -277,6 +373,8 @@ const (
 %token<token> FIRST
 %token<token> OFFSET
 %token<token> AND
+%token<token> OR
+%token<token> NOT
 %token<token> IS
 %token<token> NULL
 %token<token> CONTAINS
@@ -289,6 +387,14 @@ const (
 %token<token> NAMESPACE
 %token<token> BLOB
 %token<token> DATETIME
+%token<token> ARRAY
+%token<token> AGGREGATE
+%token<token> OVER
+%token<token> AS
+%token<token> COUNT
+%token<token> COUNT_UP_TO
+%token<token> SUM
+%token<token> AVG
 %token<token> TRUE       // true literal
 %token<token> FALSE      // false literal
 
@@ -302,6 +408,16 @@ query
         $$ = $1
         yylex.(*Lexer).Result = $$
     }
+    | AGGREGATE aggregations OVER LEFT_ROUND select RIGHT_ROUND
+    {
+        s := $5.(SelectExpr)
+        if len(s.Aggregations) > 0 {
+            yylex.Error("nested aggregation")
+        }
+        s.Aggregations = $2.([]AggregationExpr)
+        $$ = s
+        yylex.(*Lexer).Result = $$
+    }
 
 select
     : SELECT Field opt_from opt_where opt_order opt_limit opt_offset
@@ -337,6 +453,82 @@ select
             Offset: offset,
         }
     }
+    | SELECT aggregations opt_from opt_where opt_order opt_limit opt_offset
+    {
+        var from *FromExpr
+        if $3 != nil {
+            from = $3.(*FromExpr)
+        }
+
+        var limit *LimitExpr
+        if $6 != nil {
+            limit = $6.(*LimitExpr)
+        }
+
+        var offset *OffsetExpr
+        if $7 != nil {
+            offset = $7.(*OffsetExpr)
+        }
+
+        $$ = SelectExpr{
+            Aggregations: $2.([]AggregationExpr),
+            From: from,
+            Where: $4.([]ConditionExpr),
+            Order: $5.([]OrderExpr),
+            Limit: limit,
+            Offset: offset,
+        }
+    }
+
+aggregations
+    : aggregation
+    {
+        $$ = []AggregationExpr{ $1.(AggregationExpr) }
+    }
+    | aggregations COMMA aggregation
+    {
+        $$ = append($1.([]AggregationExpr), $3.(AggregationExpr))
+    }
+
+aggregation
+    : aggregate_function opt_alias
+    {
+        a := $1.(AggregationExpr)
+        a.Alias = $2.(string)
+        $$ = a
+    }
+
+aggregate_function
+    : COUNT LEFT_ROUND ASTERISK RIGHT_ROUND
+    {
+        $$ = AggregationExpr{Function: AGG_COUNT}
+    }
+    | COUNT_UP_TO LEFT_ROUND INTEGER RIGHT_ROUND
+    {
+        number, err := strconv.Atoi($3.literal)
+        if err != nil {
+            panic(fmt.Sprintf("can't convert %v to integer", $3.literal))
+        }
+        $$ = AggregationExpr{Function: AGG_COUNT_UP_TO, UpTo: number}
+    }
+    | SUM LEFT_ROUND property_name RIGHT_ROUND
+    {
+        $$ = AggregationExpr{Function: AGG_SUM, PropertyName: $3.(string)}
+    }
+    | AVG LEFT_ROUND property_name RIGHT_ROUND
+    {
+        $$ = AggregationExpr{Function: AGG_AVG, PropertyName: $3.(string)}
+    }
+
+opt_alias
+    :
+    {
+        $$ = ""
+    }
+    | AS NAME
+    {
+        $$ = $2.literal
+    }
 
 Field
     : ASTERISK
@@ -401,13 +593,43 @@ opt_where
     }
 
 compound_condition
+    : or_condition
+    {
+        if c, ok := $1.(CompositeConditionExpr); ok && c.Operator == LOGICAL_AND {
+            $$ = c.Conditions
+        } else {
+            $$ = []ConditionExpr{ $1.(ConditionExpr) }
+        }
+    }
+
+or_condition
+    : and_condition
+    {
+        $$ = $1
+    }
+    | or_condition OR and_condition
+    {
+        $$ = newCompositeCondition(LOGICAL_OR, $1.(ConditionExpr), $3.(ConditionExpr))
+    }
+
+and_condition
+    : primary_condition
+    {
+        $$ = $1
+    }
+    | and_condition AND primary_condition
+    {
+        $$ = newCompositeCondition(LOGICAL_AND, $1.(ConditionExpr), $3.(ConditionExpr))
+    }
+
+primary_condition
     : condition
     {
-        $$ = []ConditionExpr{ $1.(ConditionExpr) }
+        $$ = $1
     }
-    | compound_condition AND condition
+    | LEFT_ROUND or_condition RIGHT_ROUND
     {
-        $$ = append($1.([]ConditionExpr), $3.(ConditionExpr))
+        $$ = $2
     }
 
 condition
@@ -447,6 +669,14 @@ forward_comparator
     {
         $$ = OP_HAS_ANCESTOR
     }
+    | IN
+    {
+        $$ = OP_IN
+    }
+    | NOT IN
+    {
+        $$ = OP_NOT_IN
+    }
 
 backward_comparator
     : either_comparator
@@ -483,6 +713,10 @@ either_comparator
     {
         $$ = OP_GREATER_EQUALS
     }
+    | EXCLAMATION EQUAL
+    {
+        $$ = OP_NOT_EQUALS
+    }
 
 opt_order
     :
@@ -626,6 +860,20 @@ value
     {
         $$ = ValueExpr{Type:TYPE_NULL, V:nil }
     }
+    | ARRAY LEFT_ROUND values RIGHT_ROUND
+    {
+        $$ = ValueExpr{Type:TYPE_ARRAY, V:$3.([]ValueExpr) }
+    }
+
+values
+    : value
+    {
+        $$ = []ValueExpr{ $1.(ValueExpr) }
+    }
+    | values COMMA value
+    {
+        $$ = append($1.([]ValueExpr), $3.(ValueExpr))
+    }
 
 synthetic_literal
     : KEY LEFT_ROUND opt_project opt_namespace key_path_elements RIGHT_ROUND
@@ -652,7 +900,7 @@ synthetic_literal
 opt_project
     :
     {
-        $$ = nil
+        $$ = ""
     }
     | PROJECT LEFT_ROUND STRING RIGHT_ROUND COMMA
     {
@@ -662,7 +910,7 @@ opt_project
 opt_namespace
     :
     {
-        $$ = nil
+        $$ = ""
     }
     | NAMESPACE LEFT_ROUND STRING RIGHT_ROUND COMMA
     {
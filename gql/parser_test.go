@@ -129,6 +129,30 @@ func TestWhereBackward(t *testing.T) {
 	assert.Equal(t, "xyz", cond.Value.V.(string))
 }
 
+func TestWhereIsNull(t *testing.T) {
+	q := qry(t, "SELECT * FROM Book WHERE a IS NULL")
+	cond, ok := q.Where[0].(IsNullConditionExpr)
+	assert.True(t, ok)
+	assert.Equal(t, "a", cond.GetPropertyName())
+	assert.Equal(t, OP_IS_NULL, cond.GetComparator())
+}
+
+func TestWhereInArray(t *testing.T) {
+	q := qry(t, "SELECT * FROM Book WHERE a IN ARRAY(1, 'abc', ARRAY(true))")
+	cond, ok := q.Where[0].(ForwardConditionExpr)
+	assert.True(t, ok)
+	assert.Equal(t, "a", cond.PropertyName)
+	assert.Equal(t, OP_IN, cond.Comparator)
+	assert.Equal(t, TYPE_ARRAY, cond.Value.Type)
+
+	values := cond.Value.V.([]ValueExpr)
+	assert.Equal(t, 3, len(values))
+	assert.Equal(t, int64(1), values[0].V.(int64))
+	assert.Equal(t, "abc", values[1].V.(string))
+	assert.Equal(t, TYPE_ARRAY, values[2].Type)
+	assert.Equal(t, true, values[2].V.([]ValueExpr)[0].V.(bool))
+}
+
 func TestWhereKey(t *testing.T) {
 	q := qry(t, "SELECT * FROM Book WHERE a = KEY(PROJECT('sample-123'), NAMESPACE('sampe-space'),Auther,'Huxley',Book,1234)")
 	cond, ok := q.Where[0].(ForwardConditionExpr)
@@ -146,6 +170,26 @@ func TestWhereKey(t *testing.T) {
 	assert.Equal(t, int64(1234), keyLiteral.KeyPath[1].ID)
 }
 
+func TestWhereKeyPath(t *testing.T) {
+	q := qry(t, "SELECT * FROM Book WHERE __key__ = KEY(Book, 1234)")
+	keyLiteral := q.Where[0].GetValue().V.(KeyLiteralExpr)
+	assert.Equal(t, "", keyLiteral.Project)
+	assert.Equal(t, "", keyLiteral.Namespace)
+	assert.Equal(t, []KeyPathElementExpr{{Kind: "Book", ID: 1234}}, keyLiteral.KeyPath)
+
+	q = qry(t, "SELECT * FROM Book WHERE __key__ = KEY(NAMESPACE('dev'), Auther, 'Huxley', Book, '1234')")
+	keyLiteral = q.Where[0].GetValue().V.(KeyLiteralExpr)
+	assert.Equal(t, "", keyLiteral.Project)
+	assert.Equal(t, "dev", keyLiteral.Namespace)
+	assert.Equal(t, []KeyPathElementExpr{{Kind: "Auther", Name: "Huxley"}, {Kind: "Book", Name: "1234"}}, keyLiteral.KeyPath)
+
+	q = qry(t, "SELECT * FROM Book WHERE KEY(PROJECT('sample-123'), Auther, 10) HAS DESCENDANT __key__")
+	keyLiteral = q.Where[0].GetValue().V.(KeyLiteralExpr)
+	assert.Equal(t, "sample-123", keyLiteral.Project)
+	assert.Equal(t, "", keyLiteral.Namespace)
+	assert.Equal(t, []KeyPathElementExpr{{Kind: "Auther", ID: 10}}, keyLiteral.KeyPath)
+}
+
 func TestWhereBlob(t *testing.T) {
 	q := qry(t, "SELECT * FROM Book WHERE a = BLOB('abcd')")
 	cond, ok := q.Where[0].(ForwardConditionExpr)
@@ -166,6 +210,37 @@ func TestWhereDatetime(t *testing.T) {
 	assert.Equal(t, "2013-09-29T09:30:20-08:00", cond.Value.V.(time.Time).Format(time.RFC3339))
 }
 
+func TestWhereOr(t *testing.T) {
+	q := qry(t, "SELECT * FROM Book WHERE a = 1 AND (b = 2 OR c = 3 AND d = 4) AND e = 5")
+	assert.Equal(t, 3, len(q.Where))
+	assert.Equal(t, "a", q.Where[0].GetPropertyName())
+	assert.Equal(t, "e", q.Where[2].GetPropertyName())
+
+	or, ok := q.Where[1].(CompositeConditionExpr)
+	assert.True(t, ok)
+	assert.Equal(t, LOGICAL_OR, or.Operator)
+	assert.Equal(t, 2, len(or.Conditions))
+	assert.Equal(t, "b", or.Conditions[0].GetPropertyName())
+
+	and, ok := or.Conditions[1].(CompositeConditionExpr)
+	assert.True(t, ok)
+	assert.Equal(t, LOGICAL_AND, and.Operator)
+	assert.Equal(t, "c", and.Conditions[0].GetPropertyName())
+	assert.Equal(t, "d", and.Conditions[1].GetPropertyName())
+
+	// nested OR is flattened
+	q = qry(t, "SELECT * FROM Book WHERE a = 1 OR (b = 2 OR c = 3)")
+	assert.Equal(t, 1, len(q.Where))
+	assert.Equal(t, 3, len(q.Where[0].(CompositeConditionExpr).Conditions))
+}
+
+func TestWhereNotEquals(t *testing.T) {
+	q := qry(t, "SELECT * FROM Book WHERE a != 1 AND b NOT IN ARRAY(1, 2)")
+	assert.Equal(t, OP_NOT_EQUALS, q.Where[0].GetComparator())
+	assert.Equal(t, OP_NOT_IN, q.Where[1].GetComparator())
+	assert.Equal(t, TYPE_ARRAY, q.Where[1].GetValue().Type)
+}
+
 func TestOrder(t *testing.T) {
 	q := qry(t, "SELECT * ORDER BY abc, def ASC, ghi DESC")
 	assert.Equal(t, "abc", q.Order[0].PropertyName)
@@ -200,6 +275,32 @@ func TestOffsetCursor(t *testing.T) {
 	assert.Equal(t, 12, q.Offset.Number)
 }
 
+func TestAggregation(t *testing.T) {
+	q := qry(t, "SELECT COUNT(*) AS total, SUM(price), AVG(price) AS average FROM Book WHERE a = 1")
+	assert.Equal(t, []AggregationExpr{
+		{Function: AGG_COUNT, Alias: "total"},
+		{Function: AGG_SUM, PropertyName: "price"},
+		{Function: AGG_AVG, PropertyName: "price", Alias: "average"},
+	}, q.Aggregations)
+	assert.Equal(t, "Book", q.From.Kind.Name)
+	assert.Equal(t, 1, len(q.Where))
+
+	q = qry(t, "SELECT COUNT_UP_TO(100) FROM Book")
+	assert.Equal(t, []AggregationExpr{{Function: AGG_COUNT_UP_TO, UpTo: 100}}, q.Aggregations)
+}
+
+func TestAggregateOver(t *testing.T) {
+	q := qry(t, "AGGREGATE COUNT(*) AS total OVER (SELECT * FROM Book WHERE a = 1 LIMIT 10)")
+	assert.Equal(t, []AggregationExpr{{Function: AGG_COUNT, Alias: "total"}}, q.Aggregations)
+	assert.Equal(t, "Book", q.From.Kind.Name)
+	assert.Equal(t, 1, len(q.Where))
+	assert.Equal(t, 10, q.Limit.Number)
+
+	l := new(Lexer)
+	l.Scanner = NewScanner(strings.NewReader("AGGREGATE COUNT(*) OVER (SELECT COUNT(*) FROM Book)"))
+	assert.NotNil(t, l.Parse())
+}
+
 func TestSyntaxErr(t *testing.T) {
 	query := "SELECT limit"
 
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -21,39 +22,60 @@ var (
 		'>': RIGHT_BRACKETS,
 		'(': LEFT_ROUND,
 		')': RIGHT_ROUND,
+		'!': EXCLAMATION,
 	}
 
 	keywords = map[string]TokenType{
-		"SELECT":     SELECT,
-		"DISTINCT":   DISTINCT,
-		"ON":         ON,
-		"FROM":       FROM,
-		"WHERE":      WHERE,
-		"ASC":        ASC,
-		"DESC":       DESC,
-		"ORDER":      ORDER,
-		"BY":         BY,
-		"LIMIT":      LIMIT,
-		"FIRST":      FIRST,
-		"OFFSET":     OFFSET,
-		"AND":        AND,
-		"IS":         IS,
-		"NULL":       NULL,
-		"CONTAINS":   CONTAINS,
-		"HAS":        HAS,
-		"ANCESTOR":   ANCESTOR,
-		"DESCENDANT": DESCENDANT,
-		"IN":         IN,
-		"KEY":        KEY,
-		"PROJECT":    PROJECT,
-		"NAMESPACE":  NAMESPACE,
-		"BLOB":       BLOB,
-		"DATETIME":   DATETIME,
-		"TRUE":       TRUE,
-		"FALSE":      FALSE,
+		"SELECT":      SELECT,
+		"DISTINCT":    DISTINCT,
+		"ON":          ON,
+		"FROM":        FROM,
+		"WHERE":       WHERE,
+		"ASC":         ASC,
+		"DESC":        DESC,
+		"ORDER":       ORDER,
+		"BY":          BY,
+		"LIMIT":       LIMIT,
+		"FIRST":       FIRST,
+		"OFFSET":      OFFSET,
+		"AND":         AND,
+		"OR":          OR,
+		"NOT":         NOT,
+		"IS":          IS,
+		"NULL":        NULL,
+		"CONTAINS":    CONTAINS,
+		"HAS":         HAS,
+		"ANCESTOR":    ANCESTOR,
+		"DESCENDANT":  DESCENDANT,
+		"IN":          IN,
+		"KEY":         KEY,
+		"PROJECT":     PROJECT,
+		"NAMESPACE":   NAMESPACE,
+		"BLOB":        BLOB,
+		"DATETIME":    DATETIME,
+		"ARRAY":       ARRAY,
+		"AGGREGATE":   AGGREGATE,
+		"OVER":        OVER,
+		"AS":          AS,
+		"COUNT":       COUNT,
+		"COUNT_UP_TO": COUNT_UP_TO,
+		"SUM":         SUM,
+		"AVG":         AVG,
+		"TRUE":        TRUE,
+		"FALSE":       FALSE,
 	}
 )
 
+// Keywords returns reserved words of GQL in alphabetical order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for w := range keywords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
 // Scanner represents a lexical scanner.
 type Scanner struct {
 	r   *bufio.Reader
@@ -173,7 +195,7 @@ func (s *Scanner) scanName() (tok TokenType, lit string) {
 	for {
 		if ch := s.read(); ch == eof {
 			break
-		} else if !isLetter(ch) && !isDigit(ch) && ch != '_' && ch != '.' {
+		} else if !isLetter(ch) && !isNumber(ch) && ch != '_' && ch != '.' {
 			s.unread()
 			break
 		} else {
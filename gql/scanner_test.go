@@ -66,6 +66,23 @@ func TestScannerLiteralsOK(t *testing.T) {
 	assert.Equal(t, "1.23e-29", lit)
 }
 
+func TestScannerBindingSiteOK(t *testing.T) {
+	q := "@name0 @10 name10"
+	s := NewScanner(strings.NewReader(q))
+
+	tok, lit := scan(s)
+	assert.Equal(t, BINDING_SITE, tok)
+	assert.Equal(t, "name0", lit)
+
+	tok, lit = scan(s)
+	assert.Equal(t, BINDING_SITE, tok)
+	assert.Equal(t, "10", lit)
+
+	tok, lit = scan(s)
+	assert.Equal(t, NAME, tok)
+	assert.Equal(t, "name10", lit)
+}
+
 func TestScannerNameNG(t *testing.T) {
 	q := " 'name "
 	s := NewScanner(strings.NewReader(q))